@@ -85,6 +85,37 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// Binds the elements of an array to several names at once: "let [a, b] = [1, 2];"
+// Binding to "_" discards the element
+type DestructuringStatement struct {
+	Token token.Token   // The token.LET token
+	Names []*Identifier // Names bound to the array's elements, in order
+	Value Expression    // The array being destructured
+}
+
+func (ds *DestructuringStatement) statementNode()       {}
+func (ds *DestructuringStatement) TokenLiteral() string { return ds.Token.Literal }
+
+func (ds *DestructuringStatement) String() string {
+	// let [a, b] = pair;
+	var out bytes.Buffer
+
+	names := []string{}
+	for _, name := range ds.Names {
+		names = append(names, name.String())
+	}
+
+	out.WriteString(ds.TokenLiteral() + " ")
+	out.WriteString("[" + strings.Join(names, ", ") + "]")
+	out.WriteString(" = ")
+	if ds.Value != nil {
+		out.WriteString(ds.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
 // The identifier for a let statement / variable: "x", "foobar"
 // Identifiers are treated as expressions because they represent values that can be evaluated.
 type Identifier struct {
@@ -146,6 +177,16 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// Represents a floating point value: "1.5", "0.25"
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 // Represents ant prefix expression. In Clear, these are only "!" and "-"
 type PrefixExpression struct {
 	Token    token.Token // The prefix token: "!", "-"
@@ -187,6 +228,44 @@ func (oe *InfixExpression) String() string {
 	return out.String()
 }
 
+// Adds or subtracts one from a variable, storing the result back in it: "++i", "i--"
+// The prefix form evaluates to the updated value, while the postfix form evaluates to the value from before the update
+type IncrementExpression struct {
+	Token    token.Token // The "++" or "--" token
+	Operator string      // "++" or "--"
+	Name     *Identifier // The variable being updated
+	Prefix   bool        // Whether the operator comes before the name
+}
+
+func (ie *IncrementExpression) expressionNode()      {}
+func (ie *IncrementExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IncrementExpression) String() string {
+	if ie.Prefix {
+		return "(" + ie.Operator + ie.Name.String() + ")"
+	}
+	return "(" + ie.Name.String() + ie.Operator + ")"
+}
+
+// Stores a value in an existing variable or in an element of an array or hash: "x = 5", "arr[1] = 99"
+// Evaluates to the assigned value, so assignments can be chained: "a = b = 5"
+type AssignExpression struct {
+	Token  token.Token // The "=" token
+	Target Expression  // Where the value is stored: "x", "arr[1]"
+	Value  Expression  // The value being assigned: "99"
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+	return out.String()
+}
+
 // Represents a boolean value: true, false
 type Boolean struct {
 	Token token.Token // The token.TRUE or token.FALSE token
@@ -264,6 +343,30 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// Represents a macro definition: "macro(cond, body) { quote(...) }"
+// Macros are bound by the expansion pass before evaluation, and receive their arguments as unevaluated code
+type MacroLiteral struct {
+	Token      token.Token // The 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+	return out.String()
+}
+
 // Represents a call to a defined function
 // Contains a function identifier and a list of function arguments encased in parentheses and separated by commas
 type CallExpression struct {
@@ -286,3 +389,134 @@ func (ce *CallExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+
+// Represents an array literal: "[1, 2 * 2, fn(x) { x }]"
+// Elements can be any expression
+type ArrayLiteral struct {
+	Token    token.Token // The '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// Represents accessing an element by index: "myArray[0]", "[1, 2, 3][1 + 1]"
+type IndexExpression struct {
+	Token token.Token // The '[' token
+	Left  Expression  // The object being indexed
+	Index Expression  // The index being accessed. Can be any expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+	return out.String()
+}
+
+// Represents a string literal: "hello world"
+type StringLiteral struct {
+	Token token.Token // The token.STRING token
+	Value string      // The contents of the string, without the quotes
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+
+// Represents a hash literal: "{"one": 1, "two": 2}"
+// Keys and values can be any expression
+type HashLiteral struct {
+	Token token.Token // The '{' token
+	Pairs map[Expression]Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for key, value := range hl.Pairs {
+		pairs = append(pairs, key.String()+":"+value.String())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// Represents calling a method on a receiver: ""hello".len()", "name.upper()"
+// Methods are sugar for calling the builtin of the same name with the receiver as the first argument
+type MethodCallExpression struct {
+	Token     token.Token  // The '.' token
+	Receiver  Expression   // The expression the method is called on
+	Method    *Identifier  // Name of the method being called
+	Arguments []Expression // Arguments passed after the receiver
+}
+
+func (mc *MethodCallExpression) expressionNode()      {}
+func (mc *MethodCallExpression) TokenLiteral() string { return mc.Token.Literal }
+func (mc *MethodCallExpression) String() string {
+	var out bytes.Buffer
+	args := []string{}
+	for _, a := range mc.Arguments {
+		args = append(args, a.String())
+	}
+	out.WriteString(mc.Receiver.String())
+	out.WriteString(".")
+	out.WriteString(mc.Method.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+
+// Represents a block used as an expression: "{ let x = 5; x * 2 }"
+// Its value is the value of its last statement
+type BlockExpression struct {
+	Token token.Token // The '{' token
+	Block *BlockStatement
+}
+
+func (be *BlockExpression) expressionNode()      {}
+func (be *BlockExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BlockExpression) String() string {
+	return "{ " + be.Block.String() + " }"
+}
+
+// Represents a string with embedded expressions: "Hello, ${name}!"
+// Parts alternate between the literal text (as string literals) and the embedded expressions, in the order they appear
+type TemplateStringLiteral struct {
+	Token token.Token // The token.TEMPLATE token
+	Parts []Expression
+}
+
+func (tl *TemplateStringLiteral) expressionNode()      {}
+func (tl *TemplateStringLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TemplateStringLiteral) String() string {
+	var out bytes.Buffer
+	for _, part := range tl.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(strings.ReplaceAll(text.Value, "${", "\\${"))
+			continue
+		}
+		out.WriteString("${" + part.String() + "}")
+	}
+	return out.String()
+}
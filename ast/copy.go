@@ -0,0 +1,163 @@
+package ast
+
+// Returns a deep copy of the AST, so the copy can be changed (by Modify, for example) without changing the original
+// Tokens are copied along with the nodes, so the copy keeps the original's source positions
+func Copy(node Node) Node {
+	switch node := node.(type) {
+
+	// Statements
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: node.Token, Expression: copyExpression(node.Expression)}
+
+	case *LetStatement:
+		return &LetStatement{Token: node.Token, Name: copyIdentifier(node.Name), Value: copyExpression(node.Value)}
+
+	case *DestructuringStatement:
+		return &DestructuringStatement{Token: node.Token, Names: copyIdentifiers(node.Names), Value: copyExpression(node.Value)}
+
+	case *ReturnStatement:
+		return &ReturnStatement{Token: node.Token, ReturnValue: copyExpression(node.ReturnValue)}
+
+	case *BlockStatement:
+		return copyBlock(node)
+
+	// Expressions
+	case *Identifier:
+		return copyIdentifier(node)
+
+	case *IntegerLiteral:
+		copied := *node
+		return &copied
+
+	case *FloatLiteral:
+		copied := *node
+		return &copied
+
+	case *Boolean:
+		copied := *node
+		return &copied
+
+	case *StringLiteral:
+		copied := *node
+		return &copied
+
+	case *PrefixExpression:
+		return &PrefixExpression{Token: node.Token, Operator: node.Operator, Right: copyExpression(node.Right)}
+
+	case *InfixExpression:
+		return &InfixExpression{Token: node.Token, Left: copyExpression(node.Left), Operator: node.Operator, Right: copyExpression(node.Right)}
+
+	case *IncrementExpression:
+		return &IncrementExpression{Token: node.Token, Operator: node.Operator, Name: copyIdentifier(node.Name), Prefix: node.Prefix}
+
+	case *AssignExpression:
+		return &AssignExpression{Token: node.Token, Target: copyExpression(node.Target), Value: copyExpression(node.Value)}
+
+	case *IndexExpression:
+		return &IndexExpression{Token: node.Token, Left: copyExpression(node.Left), Index: copyExpression(node.Index)}
+
+	case *IfExpression:
+		return &IfExpression{
+			Token:       node.Token,
+			Condition:   copyExpression(node.Condition),
+			Consequence: copyBlock(node.Consequence),
+			Alternative: copyBlock(node.Alternative),
+		}
+
+	case *BlockExpression:
+		return &BlockExpression{Token: node.Token, Block: copyBlock(node.Block)}
+
+	case *FunctionLiteral:
+		return &FunctionLiteral{Token: node.Token, Parameters: copyIdentifiers(node.Parameters), Body: copyBlock(node.Body)}
+
+	case *MacroLiteral:
+		return &MacroLiteral{Token: node.Token, Parameters: copyIdentifiers(node.Parameters), Body: copyBlock(node.Body)}
+
+	case *CallExpression:
+		return &CallExpression{Token: node.Token, Function: copyExpression(node.Function), Arguments: copyExpressions(node.Arguments)}
+
+	case *MethodCallExpression:
+		return &MethodCallExpression{
+			Token:     node.Token,
+			Receiver:  copyExpression(node.Receiver),
+			Method:    copyIdentifier(node.Method),
+			Arguments: copyExpressions(node.Arguments),
+		}
+
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		for key, value := range node.Pairs {
+			pairs[copyExpression(key)] = copyExpression(value)
+		}
+		return &HashLiteral{Token: node.Token, Pairs: pairs}
+
+	case *TemplateStringLiteral:
+		return &TemplateStringLiteral{Token: node.Token, Parts: copyExpressions(node.Parts)}
+	}
+
+	return node
+}
+
+// The helpers below keep nil children nil, rather than turning them into typed nils inside an interface
+
+func copyExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	copied, _ := Copy(exp).(Expression)
+	return copied
+}
+
+func copyExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	copied := make([]Expression, len(exps))
+	for i, exp := range exps {
+		copied[i] = copyExpression(exp)
+	}
+	return copied
+}
+
+func copyStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	copied := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		copied[i], _ = Copy(stmt).(Statement)
+	}
+	return copied
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{Token: block.Token, Statements: copyStatements(block.Statements)}
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	copied := *ident
+	return &copied
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	copied := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		copied[i] = copyIdentifier(ident)
+	}
+	return copied
+}
@@ -0,0 +1,110 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ajtroup1/clearv2/token"
+)
+
+func TestCopy(t *testing.T) {
+	ident := func(name string, column int) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Line: 2, Column: column, Source: 7}, Value: name}
+	}
+	integer := func(value int64) *IntegerLiteral {
+		return &IntegerLiteral{Token: token.Token{Type: token.INT, Line: 3, Column: 1, Source: 7}, Value: value}
+	}
+
+	// let f = fn(x) { if (x > 1) { return [x, 2][0]; } else { g(x).len() } }; let [a, _] = ["${x}", f(1)];
+	original := &Program{Statements: []Statement{
+		&LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1, Source: 7},
+			Name:  ident("f", 5),
+			Value: &FunctionLiteral{
+				Parameters: []*Identifier{ident("x", 12)},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &IfExpression{
+						Condition: &InfixExpression{Left: ident("x", 20), Operator: ">", Right: integer(1)},
+						Consequence: &BlockStatement{Statements: []Statement{
+							&ReturnStatement{ReturnValue: &IndexExpression{
+								Left: &ArrayLiteral{Elements: []Expression{
+									ident("x", 30),
+									integer(2),
+								}},
+								Index: integer(0),
+							}},
+						}},
+						Alternative: &BlockStatement{Statements: []Statement{
+							&ExpressionStatement{Expression: &MethodCallExpression{
+								Receiver: &CallExpression{Function: ident("g", 50), Arguments: []Expression{ident("x", 52)}},
+								Method:   ident("len", 55),
+							}},
+						}},
+					}},
+				}},
+			},
+		},
+		&DestructuringStatement{
+			Names: []*Identifier{ident("a", 6), ident("_", 9)},
+			Value: &ArrayLiteral{Elements: []Expression{
+				&TemplateStringLiteral{Parts: []Expression{ident("x", 17)}},
+				&CallExpression{Function: ident("f", 22), Arguments: []Expression{integer(1)}},
+			}},
+		},
+		&ExpressionStatement{Expression: &BlockExpression{Block: &BlockStatement{Statements: []Statement{
+			&ExpressionStatement{Expression: &AssignExpression{Target: ident("a", 1), Value: &PrefixExpression{Operator: "-", Right: &FloatLiteral{Value: 1.5}}}},
+			&ExpressionStatement{Expression: &IncrementExpression{Operator: "++", Name: ident("a", 1), Prefix: true}},
+			&ExpressionStatement{Expression: &Boolean{Value: true}},
+		}}}},
+	}}
+
+	copied := Copy(original)
+	if !reflect.DeepEqual(copied, original) {
+		t.Fatalf("copy differs from the original.\nexpected=%s\ngot=     %s", original.String(), copied.String())
+	}
+
+	// Changing the copy must leave the original alone
+	Modify(copied, func(node Node) Node {
+		switch node := node.(type) {
+		case *Identifier:
+			node.Value = "changed"
+		case *IntegerLiteral:
+			node.Value = 99
+		}
+		return node
+	})
+	fn := original.Statements[0].(*LetStatement).Value.(*FunctionLiteral)
+	condition := fn.Body.Statements[0].(*ExpressionStatement).Expression.(*IfExpression).Condition.(*InfixExpression)
+	if got := condition.Left.(*Identifier).Value; got != "x" {
+		t.Errorf("modifying the copy changed the original's identifier to %q", got)
+	}
+	call := original.Statements[1].(*DestructuringStatement).Value.(*ArrayLiteral).Elements[1].(*CallExpression)
+	if got := call.Arguments[0].(*IntegerLiteral).Value; got != 1 {
+		t.Errorf("modifying the copy changed the original's argument to %d", got)
+	}
+
+	// Hash keys are copied too, so the copy's map has different keys that hold the same code
+	hash := &HashLiteral{Pairs: map[Expression]Expression{&StringLiteral{Value: "a"}: ident("x", 40)}}
+	copiedHash := Copy(hash).(*HashLiteral)
+	for key, value := range copiedHash.Pairs {
+		if _, ok := hash.Pairs[key]; ok {
+			t.Errorf("hash key was shared with the original")
+		}
+		if !reflect.DeepEqual(key, &StringLiteral{Value: "a"}) || !reflect.DeepEqual(value, ident("x", 40)) {
+			t.Errorf("hash pair copied wrong. got=%#v: %#v", key, value)
+		}
+	}
+	if len(copiedHash.Pairs) != 1 {
+		t.Errorf("hash has wrong number of pairs. expected=1, got=%d", len(copiedHash.Pairs))
+	}
+
+	// Missing children stay missing
+	ifExp := Copy(&IfExpression{Condition: &Boolean{Value: true}, Consequence: &BlockStatement{}}).(*IfExpression)
+	if ifExp.Alternative != nil {
+		t.Errorf("missing alternative was copied as %#v", ifExp.Alternative)
+	}
+	ret := Copy(&ReturnStatement{}).(*ReturnStatement)
+	if ret.ReturnValue != nil {
+		t.Errorf("missing return value was copied as %#v", ret.ReturnValue)
+	}
+}
@@ -0,0 +1,648 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/ajtroup1/clearv2/token"
+)
+
+// Serializes the given node and all of its children to JSON
+// Every node becomes an object with a "type" field naming the node ("LetStatement", "InfixExpression"...) alongside its children
+// EX. "-x" becomes {"operator":"-","right":{"type":"Identifier","value":"x"},"type":"PrefixExpression"}
+func ToJSON(node Node) ([]byte, error) {
+	value, err := toJSONValue(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// Converts a node into a tree of maps & slices that encoding/json can serialize
+// Missing nodes (like an if without an else) become null
+func toJSONValue(node Node) (interface{}, error) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return nil, nil
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		statements, err := statementsToJSON(node.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return jsonNode("Program", "statements", statements)
+
+	case *LetStatement:
+		return jsonNode("LetStatement", "name", node.Name, "value", node.Value)
+
+	case *DestructuringStatement:
+		names, err := identifiersToJSON(node.Names)
+		if err != nil {
+			return nil, err
+		}
+		return jsonNode("DestructuringStatement", "names", names, "value", node.Value)
+
+	case *ReturnStatement:
+		return jsonNode("ReturnStatement", "returnValue", node.ReturnValue)
+
+	case *ExpressionStatement:
+		return jsonNode("ExpressionStatement", "expression", node.Expression)
+
+	case *BlockStatement:
+		statements, err := statementsToJSON(node.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return jsonNode("BlockStatement", "statements", statements)
+
+	case *Identifier:
+		return jsonNode("Identifier", "value", node.Value)
+
+	case *IntegerLiteral:
+		return jsonNode("IntegerLiteral", "literal", node.Token.Literal, "value", node.Value)
+
+	case *FloatLiteral:
+		return jsonNode("FloatLiteral", "literal", node.Token.Literal, "value", node.Value)
+
+	case *StringLiteral:
+		return jsonNode("StringLiteral", "value", node.Value)
+
+	case *Boolean:
+		return jsonNode("Boolean", "value", node.Value)
+
+	case *PrefixExpression:
+		return jsonNode("PrefixExpression", "operator", node.Operator, "right", node.Right)
+
+	case *InfixExpression:
+		return jsonNode("InfixExpression", "left", node.Left, "operator", node.Operator, "right", node.Right)
+
+	case *IncrementExpression:
+		return jsonNode("IncrementExpression", "name", node.Name, "operator", node.Operator, "prefix", node.Prefix)
+
+	case *AssignExpression:
+		return jsonNode("AssignExpression", "target", node.Target, "value", node.Value)
+
+	case *IfExpression:
+		return jsonNode("IfExpression",
+			"condition", node.Condition,
+			"consequence", node.Consequence,
+			"alternative", node.Alternative,
+		)
+
+	case *FunctionLiteral:
+		params, err := identifiersToJSON(node.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		return jsonNode("FunctionLiteral", "parameters", params, "body", node.Body)
+
+	case *MacroLiteral:
+		params, err := identifiersToJSON(node.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		return jsonNode("MacroLiteral", "parameters", params, "body", node.Body)
+
+	case *CallExpression:
+		args, err := expressionsToJSON(node.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return jsonNode("CallExpression", "function", node.Function, "arguments", args)
+
+	case *ArrayLiteral:
+		elements, err := expressionsToJSON(node.Elements)
+		if err != nil {
+			return nil, err
+		}
+		return jsonNode("ArrayLiteral", "elements", elements)
+
+	case *IndexExpression:
+		return jsonNode("IndexExpression", "left", node.Left, "index", node.Index)
+
+	case *HashLiteral:
+		// Pairs are serialized as a list since JSON object keys can only be strings
+		pairs := []interface{}{}
+		for key, value := range node.Pairs {
+			pair, err := jsonNode("HashPair", "key", key, "value", value)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, pair)
+		}
+		return jsonNode("HashLiteral", "pairs", pairs)
+
+	case *MethodCallExpression:
+		args, err := expressionsToJSON(node.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return jsonNode("MethodCallExpression",
+			"receiver", node.Receiver,
+			"method", node.Method,
+			"arguments", args,
+		)
+
+	case *BlockExpression:
+		return jsonNode("BlockExpression", "block", node.Block)
+
+	case *TemplateStringLiteral:
+		parts, err := expressionsToJSON(node.Parts)
+		if err != nil {
+			return nil, err
+		}
+		return jsonNode("TemplateStringLiteral", "parts", parts)
+
+	default:
+		return nil, fmt.Errorf("cannot serialize node of type %T", node)
+	}
+}
+
+// Builds the JSON object for a node from its type name and alternating field names & values
+// Values that are nodes are converted recursively, anything else is used as is
+func jsonNode(nodeType string, fields ...interface{}) (map[string]interface{}, error) {
+	obj := map[string]interface{}{"type": nodeType}
+	for i := 0; i < len(fields); i += 2 {
+		name := fields[i].(string)
+		if child, ok := fields[i+1].(Node); ok {
+			value, err := toJSONValue(child)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = value
+		} else {
+			obj[name] = fields[i+1]
+		}
+	}
+	return obj, nil
+}
+
+// Converts a slice of statements into a JSON list
+func statementsToJSON(stmts []Statement) ([]interface{}, error) {
+	list := []interface{}{}
+	for _, s := range stmts {
+		value, err := toJSONValue(s)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// Converts a slice of expressions into a JSON list
+func expressionsToJSON(exps []Expression) ([]interface{}, error) {
+	list := []interface{}{}
+	for _, e := range exps {
+		value, err := toJSONValue(e)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// Converts a slice of identifiers into a JSON list
+func identifiersToJSON(idents []*Identifier) ([]interface{}, error) {
+	list := []interface{}{}
+	for _, i := range idents {
+		value, err := toJSONValue(i)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// Rebuilds a node from JSON produced by ToJSON
+// Tokens are reconstructed from the node type and its fields, so the rebuilt node's String() matches the original
+// Returns an error for unknown node types or malformed JSON
+func FromJSON(data []byte) (Node, error) {
+	return nodeFromJSON(data)
+}
+
+// Rebuilds a single node, dispatching on its "type" field
+// JSON null becomes a nil node
+func nodeFromJSON(data json.RawMessage) (Node, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	var nodeType string
+	if err := json.Unmarshal(fields["type"], &nodeType); err != nil {
+		return nil, fmt.Errorf("node is missing its type: %s", data)
+	}
+
+	switch nodeType {
+	case "Program":
+		statements, err := statementsFromJSON(fields["statements"])
+		if err != nil {
+			return nil, err
+		}
+		return &Program{Statements: statements}, nil
+
+	case "LetStatement":
+		name, err := identifierFromJSON(fields["name"])
+		if err != nil {
+			return nil, err
+		}
+		value, err := expressionFromJSON(fields["value"])
+		if err != nil {
+			return nil, err
+		}
+		return &LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: name, Value: value}, nil
+
+	case "DestructuringStatement":
+		names, err := identifiersFromJSON(fields["names"])
+		if err != nil {
+			return nil, err
+		}
+		value, err := expressionFromJSON(fields["value"])
+		if err != nil {
+			return nil, err
+		}
+		return &DestructuringStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Names: names, Value: value}, nil
+
+	case "ReturnStatement":
+		value, err := expressionFromJSON(fields["returnValue"])
+		if err != nil {
+			return nil, err
+		}
+		return &ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}, ReturnValue: value}, nil
+
+	case "ExpressionStatement":
+		exp, err := expressionFromJSON(fields["expression"])
+		if err != nil {
+			return nil, err
+		}
+		stmt := &ExpressionStatement{Expression: exp}
+		if exp != nil {
+			// The statement shares its expression's token literal
+			stmt.Token = token.Token{Literal: exp.TokenLiteral()}
+		}
+		return stmt, nil
+
+	case "BlockStatement":
+		statements, err := statementsFromJSON(fields["statements"])
+		if err != nil {
+			return nil, err
+		}
+		return &BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Statements: statements}, nil
+
+	case "Identifier":
+		var value string
+		if err := json.Unmarshal(fields["value"], &value); err != nil {
+			return nil, err
+		}
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: value}, Value: value}, nil
+
+	case "IntegerLiteral":
+		lit := &IntegerLiteral{Token: token.Token{Type: token.INT}}
+		if err := unmarshalFields(fields, "literal", &lit.Token.Literal, "value", &lit.Value); err != nil {
+			return nil, err
+		}
+		return lit, nil
+
+	case "FloatLiteral":
+		lit := &FloatLiteral{Token: token.Token{Type: token.FLOAT}}
+		if err := unmarshalFields(fields, "literal", &lit.Token.Literal, "value", &lit.Value); err != nil {
+			return nil, err
+		}
+		return lit, nil
+
+	case "StringLiteral":
+		var value string
+		if err := json.Unmarshal(fields["value"], &value); err != nil {
+			return nil, err
+		}
+		return &StringLiteral{Token: token.Token{Type: token.STRING, Literal: value}, Value: value}, nil
+
+	case "Boolean":
+		var value bool
+		if err := json.Unmarshal(fields["value"], &value); err != nil {
+			return nil, err
+		}
+		if value {
+			return &Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}, nil
+		}
+		return &Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}, nil
+
+	case "PrefixExpression":
+		var operator string
+		if err := json.Unmarshal(fields["operator"], &operator); err != nil {
+			return nil, err
+		}
+		right, err := expressionFromJSON(fields["right"])
+		if err != nil {
+			return nil, err
+		}
+		// Operator token types are spelled the same as the operators themselves
+		return &PrefixExpression{
+			Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+			Operator: operator,
+			Right:    right,
+		}, nil
+
+	case "InfixExpression":
+		var operator string
+		if err := json.Unmarshal(fields["operator"], &operator); err != nil {
+			return nil, err
+		}
+		left, err := expressionFromJSON(fields["left"])
+		if err != nil {
+			return nil, err
+		}
+		right, err := expressionFromJSON(fields["right"])
+		if err != nil {
+			return nil, err
+		}
+		return &InfixExpression{
+			Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+			Left:     left,
+			Operator: operator,
+			Right:    right,
+		}, nil
+
+	case "IncrementExpression":
+		var operator string
+		if err := json.Unmarshal(fields["operator"], &operator); err != nil {
+			return nil, err
+		}
+		var prefix bool
+		if err := json.Unmarshal(fields["prefix"], &prefix); err != nil {
+			return nil, err
+		}
+		name, err := identifierFromJSON(fields["name"])
+		if err != nil {
+			return nil, err
+		}
+		return &IncrementExpression{
+			Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+			Operator: operator,
+			Name:     name,
+			Prefix:   prefix,
+		}, nil
+
+	case "AssignExpression":
+		target, err := expressionFromJSON(fields["target"])
+		if err != nil {
+			return nil, err
+		}
+		value, err := expressionFromJSON(fields["value"])
+		if err != nil {
+			return nil, err
+		}
+		return &AssignExpression{Token: token.Token{Type: token.ASSIGN, Literal: "="}, Target: target, Value: value}, nil
+
+	case "IfExpression":
+		condition, err := expressionFromJSON(fields["condition"])
+		if err != nil {
+			return nil, err
+		}
+		consequence, err := blockFromJSON(fields["consequence"])
+		if err != nil {
+			return nil, err
+		}
+		alternative, err := blockFromJSON(fields["alternative"])
+		if err != nil {
+			return nil, err
+		}
+		return &IfExpression{
+			Token:       token.Token{Type: token.IF, Literal: "if"},
+			Condition:   condition,
+			Consequence: consequence,
+			Alternative: alternative,
+		}, nil
+
+	case "FunctionLiteral":
+		params, err := identifiersFromJSON(fields["parameters"])
+		if err != nil {
+			return nil, err
+		}
+		body, err := blockFromJSON(fields["body"])
+		if err != nil {
+			return nil, err
+		}
+		return &FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn"}, Parameters: params, Body: body}, nil
+
+	case "MacroLiteral":
+		params, err := identifiersFromJSON(fields["parameters"])
+		if err != nil {
+			return nil, err
+		}
+		body, err := blockFromJSON(fields["body"])
+		if err != nil {
+			return nil, err
+		}
+		return &MacroLiteral{Token: token.Token{Type: token.MACRO, Literal: "macro"}, Parameters: params, Body: body}, nil
+
+	case "CallExpression":
+		function, err := expressionFromJSON(fields["function"])
+		if err != nil {
+			return nil, err
+		}
+		args, err := expressionsFromJSON(fields["arguments"])
+		if err != nil {
+			return nil, err
+		}
+		return &CallExpression{Token: token.Token{Type: token.LPAREN, Literal: "("}, Function: function, Arguments: args}, nil
+
+	case "ArrayLiteral":
+		elements, err := expressionsFromJSON(fields["elements"])
+		if err != nil {
+			return nil, err
+		}
+		return &ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Elements: elements}, nil
+
+	case "IndexExpression":
+		left, err := expressionFromJSON(fields["left"])
+		if err != nil {
+			return nil, err
+		}
+		index, err := expressionFromJSON(fields["index"])
+		if err != nil {
+			return nil, err
+		}
+		return &IndexExpression{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Left: left, Index: index}, nil
+
+	case "HashLiteral":
+		var rawPairs []map[string]json.RawMessage
+		if err := json.Unmarshal(fields["pairs"], &rawPairs); err != nil {
+			return nil, err
+		}
+		pairs := make(map[Expression]Expression)
+		for _, raw := range rawPairs {
+			key, err := expressionFromJSON(raw["key"])
+			if err != nil {
+				return nil, err
+			}
+			value, err := expressionFromJSON(raw["value"])
+			if err != nil {
+				return nil, err
+			}
+			pairs[key] = value
+		}
+		return &HashLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Pairs: pairs}, nil
+
+	case "MethodCallExpression":
+		receiver, err := expressionFromJSON(fields["receiver"])
+		if err != nil {
+			return nil, err
+		}
+		method, err := identifierFromJSON(fields["method"])
+		if err != nil {
+			return nil, err
+		}
+		args, err := expressionsFromJSON(fields["arguments"])
+		if err != nil {
+			return nil, err
+		}
+		return &MethodCallExpression{
+			Token:     token.Token{Type: token.DOT, Literal: "."},
+			Receiver:  receiver,
+			Method:    method,
+			Arguments: args,
+		}, nil
+
+	case "BlockExpression":
+		block, err := blockFromJSON(fields["block"])
+		if err != nil {
+			return nil, err
+		}
+		return &BlockExpression{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Block: block}, nil
+
+	case "TemplateStringLiteral":
+		parts, err := expressionsFromJSON(fields["parts"])
+		if err != nil {
+			return nil, err
+		}
+		template := &TemplateStringLiteral{Parts: parts}
+		template.Token = token.Token{Type: token.TEMPLATE, Literal: template.String()}
+		return template, nil
+
+	default:
+		return nil, fmt.Errorf("unknown node type: %q", nodeType)
+	}
+}
+
+// Unmarshals alternating field names & destinations from a node's fields
+func unmarshalFields(fields map[string]json.RawMessage, namesAndDests ...interface{}) error {
+	for i := 0; i < len(namesAndDests); i += 2 {
+		name := namesAndDests[i].(string)
+		if err := json.Unmarshal(fields[name], namesAndDests[i+1]); err != nil {
+			return fmt.Errorf("invalid %q field: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Rebuilds a node that must be an expression (or null)
+func expressionFromJSON(data json.RawMessage) (Expression, error) {
+	node, err := nodeFromJSON(data)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	exp, ok := node.(Expression)
+	if !ok {
+		return nil, fmt.Errorf("expected an expression, got %T", node)
+	}
+	return exp, nil
+}
+
+// Rebuilds a node that must be a statement
+func statementFromJSON(data json.RawMessage) (Statement, error) {
+	node, err := nodeFromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	stmt, ok := node.(Statement)
+	if !ok {
+		return nil, fmt.Errorf("expected a statement, got %T", node)
+	}
+	return stmt, nil
+}
+
+// Rebuilds a list of nodes that must all be identifiers
+func identifiersFromJSON(data json.RawMessage) ([]*Identifier, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+	identifiers := []*Identifier{}
+	for _, raw := range raws {
+		identifier, err := identifierFromJSON(raw)
+		if err != nil {
+			return nil, err
+		}
+		identifiers = append(identifiers, identifier)
+	}
+	return identifiers, nil
+}
+
+// Rebuilds a node that must be an identifier
+func identifierFromJSON(data json.RawMessage) (*Identifier, error) {
+	node, err := nodeFromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	ident, ok := node.(*Identifier)
+	if !ok {
+		return nil, fmt.Errorf("expected an identifier, got %T", node)
+	}
+	return ident, nil
+}
+
+// Rebuilds a node that must be a block statement (or null)
+func blockFromJSON(data json.RawMessage) (*BlockStatement, error) {
+	node, err := nodeFromJSON(data)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		return nil, fmt.Errorf("expected a block statement, got %T", node)
+	}
+	return block, nil
+}
+
+// Rebuilds a JSON list of statements
+func statementsFromJSON(data json.RawMessage) ([]Statement, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	statements := []Statement{}
+	for _, raw := range list {
+		stmt, err := statementFromJSON(raw)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmt)
+	}
+	return statements, nil
+}
+
+// Rebuilds a JSON list of expressions
+func expressionsFromJSON(data json.RawMessage) ([]Expression, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	expressions := []Expression{}
+	for _, raw := range list {
+		exp, err := expressionFromJSON(raw)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, exp)
+	}
+	return expressions, nil
+}
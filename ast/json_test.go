@@ -0,0 +1,277 @@
+package ast
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ajtroup1/clearv2/token"
+)
+
+// let x = -5 + y;
+func jsonTestProgram() *Program {
+	return &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x"},
+					Value: "x",
+				},
+				Value: &InfixExpression{
+					Token: token.Token{Type: token.PLUS, Literal: "+"},
+					Left: &PrefixExpression{
+						Token:    token.Token{Type: token.MINUS, Literal: "-"},
+						Operator: "-",
+						Right: &IntegerLiteral{
+							Token: token.Token{Type: token.INT, Literal: "5"},
+							Value: 5,
+						},
+					},
+					Operator: "+",
+					Right: &Identifier{
+						Token: token.Token{Type: token.IDENT, Literal: "y"},
+						Value: "y",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	data, err := ToJSON(jsonTestProgram())
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatalf("ToJSON produced invalid JSON: %s", err)
+	}
+
+	if tree["type"] != "Program" {
+		t.Fatalf("root type wrong. expected=%q, got=%v", "Program", tree["type"])
+	}
+	statements := tree["statements"].([]interface{})
+	if len(statements) != 1 {
+		t.Fatalf("wrong number of statements. got=%d", len(statements))
+	}
+
+	let := statements[0].(map[string]interface{})
+	if let["type"] != "LetStatement" {
+		t.Errorf("statement type wrong. expected=%q, got=%v", "LetStatement", let["type"])
+	}
+	name := let["name"].(map[string]interface{})
+	if name["type"] != "Identifier" || name["value"] != "x" {
+		t.Errorf("let name wrong. got=%v", name)
+	}
+
+	infix := let["value"].(map[string]interface{})
+	if infix["type"] != "InfixExpression" || infix["operator"] != "+" {
+		t.Errorf("let value wrong. got=%v", infix)
+	}
+	prefix := infix["left"].(map[string]interface{})
+	if prefix["type"] != "PrefixExpression" || prefix["operator"] != "-" {
+		t.Errorf("infix left wrong. got=%v", prefix)
+	}
+	integer := prefix["right"].(map[string]interface{})
+	if integer["type"] != "IntegerLiteral" || integer["value"] != float64(5) || integer["literal"] != "5" {
+		t.Errorf("prefix right wrong. got=%v", integer)
+	}
+}
+
+func TestToJSONMissingNodes(t *testing.T) {
+	ifExp := &IfExpression{
+		Token:       token.Token{Type: token.IF, Literal: "if"},
+		Condition:   &Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true},
+		Consequence: &BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{"}},
+	}
+
+	data, err := ToJSON(ifExp)
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatalf("ToJSON produced invalid JSON: %s", err)
+	}
+	if alt, ok := tree["alternative"]; !ok || alt != nil {
+		t.Errorf("missing alternative should be null. got=%v", alt)
+	}
+	consequence := tree["consequence"].(map[string]interface{})
+	if statements := consequence["statements"].([]interface{}); len(statements) != 0 {
+		t.Errorf("empty block should have no statements. got=%v", statements)
+	}
+}
+
+func ident(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+// let f = fn(a, b) { if (a < b) { return [a, b][0]; } else { b.len() } }; f(1.5, "two", {true: !false}); let g = { let y = 5; y }; "hi ${g}"; let [_, h] = g; ++h;
+func jsonRoundTripProgram() *Program {
+	ifExp := &IfExpression{
+		Token: token.Token{Type: token.IF, Literal: "if"},
+		Condition: &InfixExpression{
+			Token: token.Token{Type: token.LT, Literal: "<"}, Left: ident("a"), Operator: "<", Right: ident("b"),
+		},
+		Consequence: &BlockStatement{
+			Token: token.Token{Type: token.LBRACE, Literal: "{"},
+			Statements: []Statement{
+				&ReturnStatement{
+					Token: token.Token{Type: token.RETURN, Literal: "return"},
+					ReturnValue: &IndexExpression{
+						Token: token.Token{Type: token.LBRACKET, Literal: "["},
+						Left: &ArrayLiteral{
+							Token:    token.Token{Type: token.LBRACKET, Literal: "["},
+							Elements: []Expression{ident("a"), ident("b")},
+						},
+						Index: &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "0"}, Value: 0},
+					},
+				},
+			},
+		},
+		Alternative: &BlockStatement{
+			Token: token.Token{Type: token.LBRACE, Literal: "{"},
+			Statements: []Statement{
+				&ExpressionStatement{
+					Token: token.Token{Type: token.IDENT, Literal: "b"},
+					Expression: &MethodCallExpression{
+						Token:     token.Token{Type: token.DOT, Literal: "."},
+						Receiver:  ident("b"),
+						Method:    ident("len"),
+						Arguments: []Expression{},
+					},
+				},
+			},
+		},
+	}
+	return &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  ident("f"),
+				Value: &FunctionLiteral{
+					Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+					Parameters: []*Identifier{ident("a"), ident("b")},
+					Body: &BlockStatement{
+						Token: token.Token{Type: token.LBRACE, Literal: "{"},
+						Statements: []Statement{
+							&ExpressionStatement{Token: ifExp.Token, Expression: ifExp},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{
+				Token: token.Token{Type: token.IDENT, Literal: "f"},
+				Expression: &CallExpression{
+					Token:    token.Token{Type: token.LPAREN, Literal: "("},
+					Function: ident("f"),
+					Arguments: []Expression{
+						&FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: "1.5"}, Value: 1.5},
+						&StringLiteral{Token: token.Token{Type: token.STRING, Literal: "two"}, Value: "two"},
+						&HashLiteral{
+							Token: token.Token{Type: token.LBRACE, Literal: "{"},
+							Pairs: map[Expression]Expression{
+								&Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}: &PrefixExpression{
+									Token:    token.Token{Type: token.BANG, Literal: "!"},
+									Operator: "!",
+									Right:    &Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false},
+								},
+							},
+						},
+					},
+				},
+			},
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  ident("g"),
+				Value: &BlockExpression{
+					Token: token.Token{Type: token.LBRACE, Literal: "{"},
+					Block: &BlockStatement{
+						Token: token.Token{Type: token.LBRACE, Literal: "{"},
+						Statements: []Statement{
+							&LetStatement{
+								Token: token.Token{Type: token.LET, Literal: "let"},
+								Name:  ident("y"),
+								Value: &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "5"}, Value: 5},
+							},
+							&ExpressionStatement{Token: token.Token{Type: token.IDENT, Literal: "y"}, Expression: ident("y")},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{
+				Token: token.Token{Type: token.TEMPLATE, Literal: "hi ${g}"},
+				Expression: &TemplateStringLiteral{
+					Token: token.Token{Type: token.TEMPLATE, Literal: "hi ${g}"},
+					Parts: []Expression{
+						&StringLiteral{Token: token.Token{Type: token.STRING, Literal: "hi "}, Value: "hi "},
+						ident("g"),
+					},
+				},
+			},
+			&DestructuringStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Names: []*Identifier{ident("_"), ident("h")},
+				Value: ident("g"),
+			},
+			&ExpressionStatement{
+				Token: token.Token{Type: token.INC, Literal: "++"},
+				Expression: &IncrementExpression{
+					Token:    token.Token{Type: token.INC, Literal: "++"},
+					Operator: "++",
+					Name:     ident("h"),
+					Prefix:   true,
+				},
+			},
+		},
+	}
+}
+
+func TestFromJSONRoundTrip(t *testing.T) {
+	for _, program := range []*Program{jsonTestProgram(), jsonRoundTripProgram()} {
+		data, err := ToJSON(program)
+		if err != nil {
+			t.Fatalf("ToJSON returned error: %s", err)
+		}
+
+		node, err := FromJSON(data)
+		if err != nil {
+			t.Fatalf("FromJSON returned error: %s", err)
+		}
+		rebuilt, ok := node.(*Program)
+		if !ok {
+			t.Fatalf("FromJSON didn't return *Program. got=%T", node)
+		}
+
+		if rebuilt.String() != program.String() {
+			t.Errorf("round trip changed the program. expected=%q, got=%q",
+				program.String(), rebuilt.String())
+		}
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"type": "WhileStatement"}`, `unknown node type: "WhileStatement"`},
+		{`{"type": "Program", "statements": [{"type": "Loop"}]}`, `unknown node type: "Loop"`},
+		{`{"type": "Program", "statements": [{"type": "Identifier", "value": "x"}]}`, "expected a statement, got *ast.Identifier"},
+		{`{"value": 5}`, `node is missing its type: {"value": 5}`},
+	}
+
+	for _, tt := range tests {
+		_, err := FromJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected error for %s", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
@@ -0,0 +1,1642 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ajtroup1/clearv2/ast"
+	"github.com/ajtroup1/clearv2/lexer"
+	"github.com/ajtroup1/clearv2/object"
+	"github.com/ajtroup1/clearv2/parser"
+)
+
+// Source of the current time for the now builtin
+// Tests (and embedders) can replace this to get a fixed, deterministic clock
+var Clock = time.Now
+
+// Pauses execution for the sleep builtin
+// Tests can replace this with a no-op so they don't actually wait
+var Sleep = time.Sleep
+
+// Random number source for the rand builtin
+// Seeded from the clock by default. The seed builtin (or tests) can reseed it for reproducible sequences
+var Random = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Environment variable access for the getenv and setenv builtins
+// LookupEnv (rather than os.Getenv) lets getenv tell an unset variable apart from an empty one
+// Tests and sandboxes can replace these to avoid touching the real process environment
+var (
+	LookupEnv = os.LookupEnv
+	Setenv    = os.Setenv
+)
+
+// Filesystem access used by the file builtins
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+// The host's real filesystem
+type osFileSystem struct{}
+
+func (osFileSystem) ReadFile(name string) ([]byte, error) { return os.ReadFile(name) }
+func (osFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+// Filesystem used by the readFile and writeFile builtins
+// Embedders can replace this to sandbox scripts (or deny file access entirely), and tests can stub it
+var Files FileSystem = osFileSystem{}
+
+// Largest array `repeat` may build, so a huge count is an error rather than exhausting memory
+var MaxRepeatLength int64 = 1 << 24
+
+// Builtins that can also be called as methods on their first argument: "hello".len()
+var methods = []string{"len", "upper", "lower"}
+
+// Returns the builtin backing the given method name, if it's callable as a method
+func lookupMethod(name string) (*object.Builtin, bool) {
+	for _, method := range methods {
+		if method == name {
+			builtin, ok := builtins[name]
+			return builtin, ok
+		}
+	}
+	return nil, false
+}
+
+// Functions built into Clear. These are resolved after the environment when evaluating identifiers
+var builtins = map[string]*object.Builtin{
+	// Returns the length of a string (in bytes), an array, or a hash (its number of pairs): "len("hello")", "len([1, 2])"
+	"len": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.String:
+				return &object.Integer{Value: int64(len(arg.Value))}
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Pairs))}
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	// Returns the current time as an integer of Unix milliseconds: "now()"
+	"now": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+			return &object.Integer{Value: Clock().UnixMilli()}
+		},
+	},
+	// Pauses for the given number of milliseconds and returns null: "sleep(100)"
+	"sleep": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			ms, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `sleep` must be INTEGER, got %s", args[0].Type())
+			}
+			if ms.Value < 0 {
+				return newError("argument to `sleep` must be non-negative, got %d", ms.Value)
+			}
+			Sleep(time.Duration(ms.Value) * time.Millisecond)
+			return NULL
+		},
+	},
+	// Returns a random integer in [0, n): "rand(10)"
+	"rand": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `rand` must be INTEGER, got %s", args[0].Type())
+			}
+			if n.Value <= 0 {
+				return newError("argument to `rand` must be positive, got %d", n.Value)
+			}
+			return &object.Integer{Value: Random.Int63n(n.Value)}
+		},
+	},
+	// Reseeds the random number source used by rand and returns null: "seed(42)"
+	"seed": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `seed` must be INTEGER, got %s", args[0].Type())
+			}
+			Random.Seed(n.Value)
+			return NULL
+		},
+	},
+	// Returns the truthiness of any value, using the same rule as conditionals: "bool(x)"
+	// Only null and false are falsy, so "bool(0)" is true
+	"bool": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return nativeBoolToBooleanObject(isTruthy(args[0]))
+		},
+	},
+	// Returns the string converted to upper case: "upper("abc")"
+	"upper": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `upper` must be STRING, got %s", args[0].Type())
+			}
+			return &object.String{Value: strings.ToUpper(str.Value)}
+		},
+	},
+	// Returns the string converted to lower case: "lower("ABC")"
+	"lower": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `lower` must be STRING, got %s", args[0].Type())
+			}
+			return &object.String{Value: strings.ToLower(str.Value)}
+		},
+	},
+	// Returns the string without leading and trailing whitespace: "trim("  hi  ")"
+	// An optional second argument trims those characters instead: "trim("xxhixx", "x")"
+	"trim": {
+		Fn: func(args ...object.Object) object.Object {
+			return trimString("trim", args, strings.TrimSpace, strings.Trim)
+		},
+	},
+	// Like trim, but only trims the start of the string: "trimLeft("  hi")"
+	"trimLeft": {
+		Fn: func(args ...object.Object) object.Object {
+			trimSpace := func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }
+			return trimString("trimLeft", args, trimSpace, strings.TrimLeft)
+		},
+	},
+	// Like trim, but only trims the end of the string: "trimRight("hi  ")"
+	"trimRight": {
+		Fn: func(args ...object.Object) object.Object {
+			trimSpace := func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }
+			return trimString("trimRight", args, trimSpace, strings.TrimRight)
+		},
+	},
+	// Returns the position of the first occurrence of a value, or -1 if it isn't found
+	// Searches strings for a substring: "indexOf("hello", "ll")", and arrays for an equal element: "indexOf([1, 2, 3], 2)"
+	// Positions within strings are byte offsets rather than characters (runes), so they line up with len, which counts bytes
+	"indexOf": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			switch container := args[0].(type) {
+			case *object.String:
+				substr, ok := args[1].(*object.String)
+				if !ok {
+					return newError("argument to `indexOf` must be STRING when searching a STRING, got %s", args[1].Type())
+				}
+				return &object.Integer{Value: int64(strings.Index(container.Value, substr.Value))}
+			case *object.Array:
+				for i, el := range container.Elements {
+					if objectsEqual(el, args[1]) {
+						return &object.Integer{Value: int64(i)}
+					}
+				}
+				return &object.Integer{Value: -1}
+			default:
+				return newError("argument to `indexOf` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	// Reports whether the string begins with the prefix: "startsWith("filename.clr", "file")"
+	"startsWith": {
+		Fn: func(args ...object.Object) object.Object {
+			return compareStrings("startsWith", args, strings.HasPrefix)
+		},
+	},
+	// Reports whether the string ends with the suffix: "endsWith("filename.clr", ".clr")"
+	"endsWith": {
+		Fn: func(args ...object.Object) object.Object {
+			return compareStrings("endsWith", args, strings.HasSuffix)
+		},
+	},
+	// Returns the number of occurrences of a value
+	// Counts non-overlapping substrings in strings: "count("banana", "a")", and equal elements in arrays: "count([1, 2, 2], 2)"
+	"count": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			switch container := args[0].(type) {
+			case *object.String:
+				substr, ok := args[1].(*object.String)
+				if !ok {
+					return newError("argument to `count` must be STRING when searching a STRING, got %s", args[1].Type())
+				}
+				return &object.Integer{Value: int64(strings.Count(container.Value, substr.Value))}
+			case *object.Array:
+				count := 0
+				for _, el := range container.Elements {
+					if objectsEqual(el, args[1]) {
+						count++
+					}
+				}
+				return &object.Integer{Value: int64(count)}
+			default:
+				return newError("argument to `count` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	// Returns the pairs of a hash as an array of two-element [key, value] arrays: "entries({"a": 1})"
+	"entries": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `entries` must be HASH, got %s", args[0].Type())
+			}
+			elements := make([]object.Object, 0, len(hash.Pairs))
+			for _, pair := range hash.Pairs {
+				elements = append(elements, &object.Array{Elements: []object.Object{pair.Key, pair.Value}})
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// Builds a hash from an array of two-element [key, value] arrays, the reverse of entries: "fromEntries([["a", 1]])"
+	"fromEntries": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `fromEntries` must be ARRAY, got %s", args[0].Type())
+			}
+			pairs := make(map[object.HashKey]object.HashPair, len(arr.Elements))
+			for i, el := range arr.Elements {
+				entry, ok := el.(*object.Array)
+				if !ok || len(entry.Elements) != 2 {
+					return newError("entry %d passed to `fromEntries` must be a [key, value] ARRAY, got %s", i, el.Inspect())
+				}
+				key, ok := entry.Elements[0].(object.Hashable)
+				if !ok {
+					return newError("unusable as hash key: %s", entry.Elements[0].Type())
+				}
+				pairs[key.HashKey()] = object.HashPair{Key: entry.Elements[0], Value: entry.Elements[1]}
+			}
+			return &object.Hash{Pairs: pairs}
+		},
+	},
+	// Returns the contents of the file at the given path as a string: "readFile("notes.txt")"
+	"readFile": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			path, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `readFile` must be STRING, got %s", args[0].Type())
+			}
+			contents, err := Files.ReadFile(path.Value)
+			if err != nil {
+				return newError("could not read file: %s", err)
+			}
+			return &object.String{Value: string(contents)}
+		},
+	},
+	// Writes a string to the file at the given path, replacing its contents, and returns null: "writeFile("notes.txt", "hello")"
+	"writeFile": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			path, ok := args[0].(*object.String)
+			if !ok {
+				return newError("first argument to `writeFile` must be STRING, got %s", args[0].Type())
+			}
+			contents, ok := args[1].(*object.String)
+			if !ok {
+				return newError("second argument to `writeFile` must be STRING, got %s", args[1].Type())
+			}
+			if err := Files.WriteFile(path.Value, []byte(contents.Value), 0644); err != nil {
+				return newError("could not write file: %s", err)
+			}
+			return NULL
+		},
+	},
+	// Returns the value of an environment variable, or null if it isn't set: "getenv("HOME")"
+	"getenv": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			key, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `getenv` must be STRING, got %s", args[0].Type())
+			}
+			value, ok := LookupEnv(key.Value)
+			if !ok {
+				return NULL
+			}
+			return &object.String{Value: value}
+		},
+	},
+	// Sets an environment variable and returns null: "setenv("MODE", "debug")"
+	"setenv": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			key, ok := args[0].(*object.String)
+			if !ok {
+				return newError("first argument to `setenv` must be STRING, got %s", args[0].Type())
+			}
+			value, ok := args[1].(*object.String)
+			if !ok {
+				return newError("second argument to `setenv` must be STRING, got %s", args[1].Type())
+			}
+			if err := Setenv(key.Value, value.Value); err != nil {
+				return newError("could not set environment variable: %s", err)
+			}
+			return NULL
+		},
+	},
+	// Returns a multi-line, indented representation of a value, for reading nested arrays and hashes: "pretty([{"a": 1}])"
+	// Strings are quoted, and hash pairs are ordered by key so the output is stable
+	"pretty": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			var out strings.Builder
+			writePretty(&out, args[0], 0)
+			return &object.String{Value: out.String()}
+		},
+	},
+	// Returns the JSON encoding of a value as a string: "jsonEncode({"a": [1, 2]})"
+	// Hash keys that aren't strings are converted to their displayed value, since JSON keys are always strings
+	"jsonEncode": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			value, err := toJSONValue(args[0])
+			if err != nil {
+				return newError("could not encode JSON: %s", err)
+			}
+			var out bytes.Buffer
+			encoder := json.NewEncoder(&out)
+			encoder.SetEscapeHTML(false) // Clear strings aren't headed for HTML, so "<" should stay "<"
+			if err := encoder.Encode(value); err != nil {
+				return newError("could not encode JSON: %s", err)
+			}
+			return &object.String{Value: strings.TrimSuffix(out.String(), "\n")}
+		},
+	},
+	// Parses a JSON string into the equivalent Clear value: "jsonDecode(text)"
+	// Objects become hashes, whole numbers become integers, and other numbers become floats
+	"jsonDecode": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `jsonDecode` must be STRING, got %s", args[0].Type())
+			}
+			if !json.Valid([]byte(str.Value)) {
+				return newError("could not decode JSON: invalid JSON")
+			}
+			decoder := json.NewDecoder(strings.NewReader(str.Value))
+			decoder.UseNumber() // Keeps integers exact instead of turning every number into a float64
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				return newError("could not decode JSON: %s", err)
+			}
+			return fromJSONValue(value)
+		},
+	},
+	// Pairs each element of an array with its index: "enumerate(["a", "b"])" is "[[0, "a"], [1, "b"]]"
+	"enumerate": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `enumerate` must be ARRAY, got %s", args[0].Type())
+			}
+			elements := make([]object.Object, len(arr.Elements))
+			for i, el := range arr.Elements {
+				elements[i] = &object.Array{Elements: []object.Object{&object.Integer{Value: int64(i)}, el}}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// Pairs up the elements of two arrays, stopping at the end of the shorter one: "zip([1, 2], ["a", "b"])" is "[[1, "a"], [2, "b"]]"
+	"zip": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			left, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("first argument to `zip` must be ARRAY, got %s", args[0].Type())
+			}
+			right, ok := args[1].(*object.Array)
+			if !ok {
+				return newError("second argument to `zip` must be ARRAY, got %s", args[1].Type())
+			}
+			length := len(left.Elements)
+			if len(right.Elements) < length {
+				length = len(right.Elements)
+			}
+			elements := make([]object.Object, length)
+			for i := 0; i < length; i++ {
+				elements[i] = &object.Array{Elements: []object.Object{left.Elements[i], right.Elements[i]}}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// Adds up an array of integers or an array of floats: "sum([1, 2, 3])" is 6, and "sum([])" is 0
+	"sum": {
+		Fn: func(args ...object.Object) object.Object {
+			return reduceNumbers("sum", args, 0,
+				func(a, b int64) int64 { return a + b },
+				func(a, b float64) float64 { return a + b },
+			)
+		},
+	},
+	// Multiplies together an array of integers or an array of floats: "product([1, 2, 3, 4])" is 24, and "product([])" is 1
+	"product": {
+		Fn: func(args ...object.Object) object.Object {
+			return reduceNumbers("product", args, 1,
+				func(a, b int64) int64 { return a * b },
+				func(a, b float64) float64 { return a * b },
+			)
+		},
+	},
+	// Returns the array without duplicate elements, keeping the first occurrence of each: "unique([1, 2, 2, 1])" is "[1, 2]"
+	"unique": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `unique` must be ARRAY, got %s", args[0].Type())
+			}
+			seen := make(map[object.HashKey]bool, len(arr.Elements))
+			elements := []object.Object{}
+			for _, el := range arr.Elements {
+				hashable, ok := el.(object.Hashable)
+				if !ok {
+					return newError("elements passed to `unique` must be hashable, got %s", el.Type())
+				}
+				key := hashable.HashKey()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				elements = append(elements, el)
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// Returns the number bounded to the range [lo, hi]: "clamp(15, 0, 10)" is 10
+	// Like arithmetic, the result is an integer if all three arguments are, and a float otherwise
+	"clamp": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			for _, arg := range args {
+				if !isNumber(arg) {
+					return newError("arguments to `clamp` must be INTEGER or FLOAT, got %s", arg.Type())
+				}
+			}
+			value, lo, hi := args[0], args[1], args[2]
+			if toFloat(lo) > toFloat(hi) {
+				return newError("lower bound passed to `clamp` must not exceed the upper bound, got %s > %s", lo.Inspect(), hi.Inspect())
+			}
+
+			result := value
+			if toFloat(value) < toFloat(lo) {
+				result = lo
+			} else if toFloat(value) > toFloat(hi) {
+				result = hi
+			}
+			if value.Type() == object.INTEGER_OBJ && lo.Type() == object.INTEGER_OBJ && hi.Type() == object.INTEGER_OBJ {
+				return result
+			}
+			return &object.Float{Value: toFloat(result)}
+		},
+	},
+	// Returns the hash used to store a value as a hash key: "hash("a")"
+	// Equal values always have equal hashes. The hash is stored unsigned, so large hashes come back as negative integers
+	"hash": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			hashable, ok := args[0].(object.Hashable)
+			if !ok {
+				return newError("argument to `hash` must be hashable, got %s", args[0].Type())
+			}
+			return &object.Integer{Value: int64(hashable.HashKey().Value)}
+		},
+	},
+	// Return their argument unchanged when it has the expected type, and an error otherwise: "asInt(5)"
+	// Unlike conversions, these never change the value. Useful for validating a function's inputs
+	"asInt":    typeAssertion(object.INTEGER_OBJ),
+	"asString": typeAssertion(object.STRING_OBJ),
+	"asBool":   typeAssertion(object.BOOLEAN_OBJ),
+	"asArray":  typeAssertion(object.ARRAY_OBJ),
+	"asHash":   typeAssertion(object.HASH_OBJ),
+	// Builds a hash from an array of keys & an array of values of the same length: "toHash(["a", "b"], [1, 2])"
+	// Later keys win when keys repeat
+	"toHash": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			keys, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("first argument to `toHash` must be ARRAY, got %s", args[0].Type())
+			}
+			values, ok := args[1].(*object.Array)
+			if !ok {
+				return newError("second argument to `toHash` must be ARRAY, got %s", args[1].Type())
+			}
+			if len(keys.Elements) != len(values.Elements) {
+				return newError("arrays passed to `toHash` must have the same length, got %d and %d", len(keys.Elements), len(values.Elements))
+			}
+			pairs := make(map[object.HashKey]object.HashPair, len(keys.Elements))
+			for i, el := range keys.Elements {
+				key, ok := el.(object.Hashable)
+				if !ok {
+					return newError("unusable as hash key: %s", el.Type())
+				}
+				pairs[key.HashKey()] = object.HashPair{Key: el, Value: values.Elements[i]}
+			}
+			return &object.Hash{Pairs: pairs}
+		},
+	},
+	// Reports whether the value is null: "isNull(if (false) { 1 })"
+	"isNull": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return nativeBoolToBooleanObject(args[0] == NULL)
+		},
+	},
+	// Splits a string into an array of its characters: "chars("abc")" is ["a", "b", "c"]
+	// Splits by rune, so multibyte characters stay whole
+	"chars": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `chars` must be STRING, got %s", args[0].Type())
+			}
+			elements := []object.Object{}
+			for _, r := range str.Value {
+				elements = append(elements, &object.String{Value: string(r)})
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// Returns the code point of a single-character string: "ord("A")" is 65
+	"ord": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `ord` must be STRING, got %s", args[0].Type())
+			}
+			if utf8.RuneCountInString(str.Value) != 1 {
+				return newError("argument to `ord` must be a single character, got %q", str.Value)
+			}
+			r, _ := utf8.DecodeRuneInString(str.Value)
+			return &object.Integer{Value: int64(r)}
+		},
+	},
+	// Returns the single-character string for a code point, the reverse of ord: "chr(65)" is "A"
+	"chr": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			code, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `chr` must be INTEGER, got %s", args[0].Type())
+			}
+			if code.Value < 0 || code.Value > utf8.MaxRune || !utf8.ValidRune(rune(code.Value)) {
+				return newError("argument to `chr` must be a valid code point, got %d", code.Value)
+			}
+			return &object.String{Value: string(rune(code.Value))}
+		},
+	},
+	// Returns a new array with the element inserted before the given index: "insert([1, 3], 1, 2)" is [1, 2, 3]
+	// An index equal to the array's length appends the element. The original array is left untouched
+	"insert": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("first argument to `insert` must be ARRAY, got %s", args[0].Type())
+			}
+			index, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("second argument to `insert` must be INTEGER, got %s", args[1].Type())
+			}
+			if index.Value < 0 || index.Value > int64(len(arr.Elements)) {
+				return newError("index out of range: %d", index.Value)
+			}
+			elements := make([]object.Object, 0, len(arr.Elements)+1)
+			elements = append(elements, arr.Elements[:index.Value]...)
+			elements = append(elements, args[2])
+			elements = append(elements, arr.Elements[index.Value:]...)
+			return &object.Array{Elements: elements}
+		},
+	},
+	// Returns a new array without the element at the given index: "removeAt([1, 2, 3], 1)" is [1, 3]
+	// The original array is left untouched
+	"removeAt": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("first argument to `removeAt` must be ARRAY, got %s", args[0].Type())
+			}
+			index, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("second argument to `removeAt` must be INTEGER, got %s", args[1].Type())
+			}
+			if index.Value < 0 || index.Value >= int64(len(arr.Elements)) {
+				return newError("index out of range: %d", index.Value)
+			}
+			elements := make([]object.Object, 0, len(arr.Elements)-1)
+			elements = append(elements, arr.Elements[:index.Value]...)
+			elements = append(elements, arr.Elements[index.Value+1:]...)
+			return &object.Array{Elements: elements}
+		},
+	},
+	// Builds a set from an array: a hash whose keys are the array's unique elements, each mapped to true: "set([1, 2, 2])"
+	"set": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `set` must be ARRAY, got %s", args[0].Type())
+			}
+			pairs := make(map[object.HashKey]object.HashPair, len(arr.Elements))
+			for _, el := range arr.Elements {
+				key, ok := el.(object.Hashable)
+				if !ok {
+					return newError("unusable as hash key: %s", el.Type())
+				}
+				pairs[key.HashKey()] = object.HashPair{Key: el, Value: TRUE}
+			}
+			return &object.Hash{Pairs: pairs}
+		},
+	},
+	// Returns a set of the keys in either of two sets: "union(set([1]), set([2]))"
+	"union": {
+		Fn: func(args ...object.Object) object.Object {
+			return setOperation("union", args, func(inLeft, inRight bool) bool { return inLeft || inRight })
+		},
+	},
+	// Returns a set of the keys in both of two sets: "intersection(set([1, 2]), set([2]))"
+	"intersection": {
+		Fn: func(args ...object.Object) object.Object {
+			return setOperation("intersection", args, func(inLeft, inRight bool) bool { return inLeft && inRight })
+		},
+	},
+	// Returns a set of the keys in the first set but not the second: "difference(set([1, 2]), set([2]))"
+	"difference": {
+		Fn: func(args ...object.Object) object.Object {
+			return setOperation("difference", args, func(inLeft, inRight bool) bool { return inLeft && !inRight })
+		},
+	},
+	// Returns a new hash with only the given keys, skipping keys the hash doesn't contain: "pick(h, ["a", "c"])"
+	"pick": {
+		Fn: func(args ...object.Object) object.Object {
+			return selectKeys("pick", args, true)
+		},
+	},
+	// Returns a new hash without the given keys: "omit(h, ["b"])"
+	"omit": {
+		Fn: func(args ...object.Object) object.Object {
+			return selectKeys("omit", args, false)
+		},
+	},
+	// Returns the [key, value] pairs of a hash sorted by key, like a stable version of entries: "sortedEntries({"b": 2, "a": 1})"
+	// The keys must all be integers or all be strings
+	"sortedEntries": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `sortedEntries` must be HASH, got %s", args[0].Type())
+			}
+			var keyType object.ObjectType
+			for _, pair := range hash.Pairs {
+				if pair.Key.Type() != object.INTEGER_OBJ && pair.Key.Type() != object.STRING_OBJ {
+					return newError("keys of hash passed to `sortedEntries` must be INTEGER or STRING, got %s", pair.Key.Type())
+				}
+				if keyType != "" && pair.Key.Type() != keyType {
+					return newError("keys of hash passed to `sortedEntries` must all have the same type, got %s and %s", keyType, pair.Key.Type())
+				}
+				keyType = pair.Key.Type()
+			}
+			pairs := sortedPairs(hash)
+			elements := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// Reports whether two values are structurally equal, comparing arrays & hashes by their contents: "equalDeep([1, [2]], [1, [2]])"
+	"equalDeep": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			return nativeBoolToBooleanObject(objectsEqual(args[0], args[1]))
+		},
+	},
+	// Returns null when two values are deeply equal, and an error naming both otherwise: "assertEqual(add(1, 2), 3)"
+	"assertEqual": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if !objectsEqual(args[0], args[1]) {
+				return newError("assertion failed: expected %s to equal %s", args[0].Inspect(), args[1].Inspect())
+			}
+			return NULL
+		},
+	},
+	// Returns null when two values aren't deeply equal, and an error naming both otherwise: "assertNotEqual(a, b)"
+	"assertNotEqual": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if objectsEqual(args[0], args[1]) {
+				return newError("assertion failed: expected %s not to equal %s", args[0].Inspect(), args[1].Inspect())
+			}
+			return NULL
+		},
+	},
+	// Writes each argument on its own line to Out: "println("a", 1)"
+	"println": {
+		Fn: func(args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Fprintln(Out, arg.Inspect())
+			}
+			return NULL
+		},
+	},
+	// Writes the arguments to Out on one line, separated by spaces and without a trailing newline: "print("a", 1)"
+	"print": {
+		Fn: func(args ...object.Object) object.Object {
+			values := make([]string, len(args))
+			for i, arg := range args {
+				values[i] = arg.Inspect()
+			}
+			fmt.Fprint(Out, strings.Join(values, " "))
+			return NULL
+		},
+	},
+}
+
+// Returns the names of all builtin functions in alphabetical order
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins)+len(evalBuiltins)+len(envBuiltins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range evalBuiltins {
+		names = append(names, name)
+	}
+	for name := range envBuiltins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builtins that need the evaluation calling them, to call back into Clear functions or to stop when it's cancelled: "iterate(f, x, 3)"
+// Each one is bound to the evaluation its name was looked up in when the identifier is evaluated
+var evalBuiltins = map[string]func(ev *evaluation, args ...object.Object) object.Object{}
+
+// Builtins that also need the environment they're called from: "locals()"
+// Bound like evalBuiltins, along with the environment the name was looked up in, which is the caller's
+var envBuiltins = map[string]func(ev *evaluation, env *object.Environment, args ...object.Object) object.Object{}
+
+// These are registered at init because they use applyFunction, which resolves identifiers against the builtin maps,
+// and Go doesn't allow that cycle in a package-level initializer
+func init() {
+	evalBuiltins["match_type"] = (*evaluation).matchType
+	evalBuiltins["iterate"] = (*evaluation).iterate
+	evalBuiltins["compose"] = (*evaluation).compose
+	evalBuiltins["partial"] = (*evaluation).partial
+	evalBuiltins["memoize"] = (*evaluation).memoize
+	evalBuiltins["apply"] = (*evaluation).apply
+	evalBuiltins["find"] = (*evaluation).find
+	evalBuiltins["findIndex"] = (*evaluation).findIndex
+	evalBuiltins["all"] = (*evaluation).allMatch
+	evalBuiltins["any"] = (*evaluation).anyMatch
+	evalBuiltins["minOf"] = (*evaluation).minOf
+	evalBuiltins["maxOf"] = (*evaluation).maxOf
+	evalBuiltins["bench"] = (*evaluation).bench
+	evalBuiltins["eval"] = (*evaluation).evalSource
+	evalBuiltins["repeat"] = (*evaluation).repeat
+	envBuiltins["locals"] = (*evaluation).locals
+	envBuiltins["callByName"] = (*evaluation).callByName
+}
+
+// Calls one of three handlers with the value depending on its type: the first for integers, the second for strings, and the third for anything else
+// "match_type(x, fn(i) { i * 2 }, fn(s) { len(s) }, fn(other) { 0 })"
+func (ev *evaluation) matchType(args ...object.Object) object.Object {
+	if len(args) != 4 {
+		return newError("wrong number of arguments. got=%d, want=4", len(args))
+	}
+	for _, handler := range args[1:] {
+		if !isCallable(handler) {
+			return newError("handlers passed to `match_type` must be FUNCTION, got %s", handler.Type())
+		}
+	}
+
+	value := args[0]
+	switch value.Type() {
+	case object.INTEGER_OBJ:
+		return ev.applyFunction(args[1], []object.Object{value})
+	case object.STRING_OBJ:
+		return ev.applyFunction(args[2], []object.Object{value})
+	default:
+		return ev.applyFunction(args[3], []object.Object{value})
+	}
+}
+
+// Applies a function to a value n times, feeding each result into the next call: "iterate(f, x, 3)" is "f(f(f(x)))"
+// Applying it 0 times returns the value unchanged
+func (ev *evaluation) iterate(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3", len(args))
+	}
+	if !isCallable(args[0]) {
+		return newError("first argument to `iterate` must be FUNCTION, got %s", args[0].Type())
+	}
+	n, ok := args[2].(*object.Integer)
+	if !ok {
+		return newError("third argument to `iterate` must be INTEGER, got %s", args[2].Type())
+	}
+	if n.Value < 0 {
+		return newError("third argument to `iterate` must be non-negative, got %d", n.Value)
+	}
+
+	result := args[1]
+	for i := int64(0); i < n.Value; i++ {
+		if err := ev.cancelled(); err != nil {
+			return err
+		}
+		result = ev.applyFunction(args[0], []object.Object{result})
+		if isError(result) {
+			return result
+		}
+	}
+	return result
+}
+
+// Returns a function that applies g and then f to the result: "compose(f, g)(x)" is "f(g(x))"
+// Any arguments to the composed function are passed on to g
+func (ev *evaluation) compose(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	for _, arg := range args {
+		if !isCallable(arg) {
+			return newError("arguments to `compose` must be FUNCTION, got %s", arg.Type())
+		}
+	}
+	f, g := args[0], args[1]
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		inner := ev.applyFunction(g, args)
+		if isError(inner) {
+			return inner
+		}
+		return ev.applyFunction(f, []object.Object{inner})
+	}}
+}
+
+// Returns a function with its leading arguments already supplied: "partial(add, 1)(2)" is "add(1, 2)"
+func (ev *evaluation) partial(args ...object.Object) object.Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+	}
+	if !isCallable(args[0]) {
+		return newError("first argument to `partial` must be FUNCTION, got %s", args[0].Type())
+	}
+	fn, leading := args[0], args[1:]
+	return &object.Builtin{Fn: func(rest ...object.Object) object.Object {
+		combined := make([]object.Object, 0, len(leading)+len(rest))
+		combined = append(combined, leading...)
+		combined = append(combined, rest...)
+		return ev.applyFunction(fn, combined)
+	}}
+}
+
+// Returns a function that caches the results of calling fn, so it's only called once for each set of arguments
+// Only meant for pure functions, and the arguments must be hashable so they can identify a cached result
+func (ev *evaluation) memoize(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	if !isCallable(args[0]) {
+		return newError("argument to `memoize` must be FUNCTION, got %s", args[0].Type())
+	}
+	fn := args[0]
+	cache := map[string]object.Object{}
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		var key strings.Builder
+		for _, arg := range args {
+			hashable, ok := arg.(object.Hashable)
+			if !ok {
+				return newError("arguments to a memoized function must be hashable, got %s", arg.Type())
+			}
+			hashKey := hashable.HashKey()
+			fmt.Fprintf(&key, "%s:%d;", hashKey.Type, hashKey.Value)
+		}
+
+		if result, ok := cache[key.String()]; ok {
+			return result
+		}
+		result := ev.applyFunction(fn, args)
+		if !isError(result) { // Errors aren't cached, so a failing call is retried
+			cache[key.String()] = result
+		}
+		return result
+	}}
+}
+
+// Reports whether the object can be called like a function
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shared implementation of the trim builtins
+// Trims whitespace when only the string is given, or the characters in the cutset when a second argument is given
+func trimString(
+	name string,
+	args []object.Object,
+	trimSpace func(string) string,
+	trimCutset func(string, string) string,
+) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+	if len(args) == 1 {
+		return &object.String{Value: trimSpace(str.Value)}
+	}
+	cutset, ok := args[1].(*object.String)
+	if !ok {
+		return newError("cutset argument to `%s` must be STRING, got %s", name, args[1].Type())
+	}
+	return &object.String{Value: trimCutset(str.Value, cutset.Value)}
+}
+
+// Shared implementation of builtins that test two strings against each other and return a boolean
+func compareStrings(
+	name string,
+	args []object.Object,
+	compare func(string, string) bool,
+) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	for _, arg := range args {
+		if arg.Type() != object.STRING_OBJ {
+			return newError("arguments to `%s` must be STRING, got %s", name, arg.Type())
+		}
+	}
+	return nativeBoolToBooleanObject(compare(
+		args[0].(*object.String).Value,
+		args[1].(*object.String).Value,
+	))
+}
+
+// Writes the indented representation of a value used by the pretty builtin
+// Arrays and hashes put each element on its own line, one level deeper than the brackets around them
+func writePretty(out *strings.Builder, obj object.Object, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch obj := obj.(type) {
+	case *object.Array:
+		if len(obj.Elements) == 0 {
+			out.WriteString("[]")
+			return
+		}
+		out.WriteString("[\n")
+		for i, el := range obj.Elements {
+			out.WriteString(indent + "  ")
+			writePretty(out, el, depth+1)
+			if i < len(obj.Elements)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "]")
+
+	case *object.Hash:
+		if len(obj.Pairs) == 0 {
+			out.WriteString("{}")
+			return
+		}
+		out.WriteString("{\n")
+		pairs := sortedPairs(obj)
+		for i, pair := range pairs {
+			out.WriteString(indent + "  ")
+			writePretty(out, pair.Key, depth+1)
+			out.WriteString(": ")
+			writePretty(out, pair.Value, depth+1)
+			if i < len(pairs)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "}")
+
+	case *object.String:
+		out.WriteString(strconv.Quote(obj.Value))
+
+	default:
+		out.WriteString(obj.Inspect())
+	}
+}
+
+// Returns the pairs of a hash ordered by key, for output that doesn't depend on Go's map order
+// Keys are compared by type first, then by their displayed value
+func sortedPairs(hash *object.Hash) []object.HashPair {
+	pairs := make([]object.HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key, pairs[j].Key
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+		if a, ok := a.(*object.Integer); ok {
+			return a.Value < b.(*object.Integer).Value
+		}
+		return a.Inspect() < b.Inspect()
+	})
+	return pairs
+}
+
+// Converts a Clear value into the Go value encoding/json encodes the same way, for the jsonEncode builtin
+// encoding/json sorts map keys, so hashes encode in a stable order
+func toJSONValue(obj object.Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		elements := make([]interface{}, 0, len(obj.Elements))
+		for _, el := range obj.Elements {
+			value, err := toJSONValue(el)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, value)
+		}
+		return elements, nil
+	case *object.Hash:
+		// JSON keys are strings, so keys of different types that print the same ("1" and 1) would overwrite each other
+		pairs := make(map[string]interface{}, len(obj.Pairs))
+		keys := make(map[string]object.Object, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key := pair.Key.Inspect()
+			if other, ok := keys[key]; ok {
+				return nil, fmt.Errorf("keys %s and %s both encode as %q", other.Type(), pair.Key.Type(), key)
+			}
+			keys[key] = pair.Key
+			value, err := toJSONValue(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			pairs[key] = value
+		}
+		return pairs, nil
+	default:
+		return nil, fmt.Errorf("%s has no JSON representation", obj.Type())
+	}
+}
+
+// Converts a value decoded by encoding/json into the equivalent Clear value, for the jsonDecode builtin
+func fromJSONValue(value interface{}) object.Object {
+	switch value := value.(type) {
+	case nil:
+		return NULL
+	case bool:
+		return nativeBoolToBooleanObject(value)
+	case string:
+		return &object.String{Value: value}
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return &object.Integer{Value: i}
+		}
+		f, _ := value.Float64() // Valid JSON numbers always parse as floats, even when they overflow an int64
+		return &object.Float{Value: f}
+	case []interface{}:
+		elements := make([]object.Object, 0, len(value))
+		for _, el := range value {
+			elements = append(elements, fromJSONValue(el))
+		}
+		return &object.Array{Elements: elements}
+	case map[string]interface{}:
+		pairs := make(map[object.HashKey]object.HashPair, len(value))
+		for k, v := range value {
+			key := &object.String{Value: k}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: fromJSONValue(v)}
+		}
+		return &object.Hash{Pairs: pairs}
+	default:
+		return newError("could not decode JSON: unexpected value %v", value)
+	}
+}
+
+// Shared implementation of the sum and product builtins
+// Folds an array of integers (or of floats) together starting from identity, which is also the result for an empty array
+func reduceNumbers(
+	name string,
+	args []object.Object,
+	identity int64,
+	intOp func(int64, int64) int64,
+	floatOp func(float64, float64) float64,
+) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	if len(arr.Elements) == 0 {
+		return &object.Integer{Value: identity}
+	}
+
+	// The first element decides whether the array is summed as integers or floats, and the rest must match it
+	elementType := arr.Elements[0].Type()
+	if elementType != object.INTEGER_OBJ && elementType != object.FLOAT_OBJ {
+		return newError("elements passed to `%s` must be INTEGER or FLOAT, got %s", name, elementType)
+	}
+	intResult, floatResult := identity, float64(identity)
+	for _, el := range arr.Elements {
+		if el.Type() != elementType {
+			return newError("elements passed to `%s` must all be %s, got %s", name, elementType, el.Type())
+		}
+		switch el := el.(type) {
+		case *object.Integer:
+			intResult = intOp(intResult, el.Value)
+		case *object.Float:
+			floatResult = floatOp(floatResult, el.Value)
+		}
+	}
+	if elementType == object.FLOAT_OBJ {
+		return &object.Float{Value: floatResult}
+	}
+	return &object.Integer{Value: intResult}
+}
+
+// Returns a builtin that passes its argument through when it's of the given type, and returns an error otherwise
+func typeAssertion(expected object.ObjectType) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != expected {
+				return newError("expected %s, got %s", expected, args[0].Type())
+			}
+			return args[0]
+		},
+	}
+}
+
+// Calls a function with the elements of an array as its arguments: "apply(add, [1, 2])" is "add(1, 2)"
+// The array must have one element for each of the function's parameters
+func (ev *evaluation) apply(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	if !isCallable(args[0]) {
+		return newError("first argument to `apply` must be FUNCTION, got %s", args[0].Type())
+	}
+	arr, ok := args[1].(*object.Array)
+	if !ok {
+		return newError("second argument to `apply` must be ARRAY, got %s", args[1].Type())
+	}
+	return ev.applyFunction(args[0], arr.Elements)
+}
+
+// Returns the first element the predicate is truthy for, or null when there's none: "find([1, 5], fn(x) { x > 2 })" is 5
+func (ev *evaluation) find(args ...object.Object) object.Object {
+	arr, index, err := ev.findMatch("find", args)
+	if err != nil {
+		return err
+	}
+	if index == -1 {
+		return NULL
+	}
+	return arr.Elements[index]
+}
+
+// Returns the index of the first element the predicate is truthy for, or -1 when there's none: "findIndex([1, 5], fn(x) { x > 2 })" is 1
+func (ev *evaluation) findIndex(args ...object.Object) object.Object {
+	_, index, err := ev.findMatch("findIndex", args)
+	if err != nil {
+		return err
+	}
+	return &object.Integer{Value: int64(index)}
+}
+
+// Validates the arguments to find or findIndex, then returns the index of the first matching element, or -1
+// Stops at the first error returned by the predicate
+func (ev *evaluation) findMatch(name string, args []object.Object) (*object.Array, int, object.Object) {
+	if len(args) != 2 {
+		return nil, 0, newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, 0, newError("first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return nil, 0, newError("second argument to `%s` must be FUNCTION, got %s", name, args[1].Type())
+	}
+	for i, el := range arr.Elements {
+		if err := ev.cancelled(); err != nil {
+			return nil, 0, err
+		}
+		result := ev.applyFunction(args[1], []object.Object{el})
+		if isError(result) {
+			return nil, 0, result
+		}
+		if isTruthy(result) {
+			return arr, i, nil
+		}
+	}
+	return arr, -1, nil
+}
+
+// Reports whether the predicate is truthy for every element: "all([2, 4], fn(x) { x > 1 })"
+// Stops at the first element it's falsy for. An empty array gives true
+func (ev *evaluation) allMatch(args ...object.Object) object.Object {
+	return ev.checkElements("all", args, false)
+}
+
+// Reports whether the predicate is truthy for at least one element: "any([1, 4], fn(x) { x > 3 })"
+// Stops at the first element it's truthy for. An empty array gives false
+func (ev *evaluation) anyMatch(args ...object.Object) object.Object {
+	return ev.checkElements("any", args, true)
+}
+
+// Applies the predicate to each element until its truthiness is stopOn, returning whether it stopped early
+// all stops on the first falsy result and any on the first truthy one, so each gives its answer without checking the rest
+func (ev *evaluation) checkElements(name string, args []object.Object, stopOn bool) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newError("second argument to `%s` must be FUNCTION, got %s", name, args[1].Type())
+	}
+	for _, el := range arr.Elements {
+		if err := ev.cancelled(); err != nil {
+			return err
+		}
+		result := ev.applyFunction(args[1], []object.Object{el})
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) == stopOn {
+			return nativeBoolToBooleanObject(stopOn)
+		}
+	}
+	return nativeBoolToBooleanObject(!stopOn)
+}
+
+// Combines two sets (or any hashes) into a new set, keeping each key for which keep returns true
+// keep is told whether the key is in the left hash and whether it's in the right one
+func setOperation(name string, args []object.Object, keep func(inLeft, inRight bool) bool) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	left, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("first argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+	right, ok := args[1].(*object.Hash)
+	if !ok {
+		return newError("second argument to `%s` must be HASH, got %s", name, args[1].Type())
+	}
+
+	pairs := map[object.HashKey]object.HashPair{}
+	for _, hash := range []*object.Hash{left, right} {
+		for hashKey, pair := range hash.Pairs {
+			_, inLeft := left.Pairs[hashKey]
+			_, inRight := right.Pairs[hashKey]
+			if keep(inLeft, inRight) {
+				pairs[hashKey] = object.HashPair{Key: pair.Key, Value: TRUE}
+			}
+		}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+// Returns the smallest element of a non-empty array: "minOf([3, 1, 2])" is 1
+// An optional function derives the value each element is compared by: "minOf(words, len)" is the shortest word
+func (ev *evaluation) minOf(args ...object.Object) object.Object {
+	return ev.extremeElement("minOf", args, -1)
+}
+
+// Returns the largest element of a non-empty array: "maxOf([3, 1, 2])" is 3
+// An optional function derives the value each element is compared by: "maxOf(words, len)" is the longest word
+func (ev *evaluation) maxOf(args ...object.Object) object.Object {
+	return ev.extremeElement("maxOf", args, 1)
+}
+
+// Returns the first element whose comparison key orders furthest in the given direction: -1 for the smallest, 1 for the largest
+// Keys are ordered like array elements, so they must all be numbers, all strings or all arrays
+func (ev *evaluation) extremeElement(name string, args []object.Object, direction int) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	if len(args) == 2 && !isCallable(args[1]) {
+		return newError("second argument to `%s` must be FUNCTION, got %s", name, args[1].Type())
+	}
+	if len(arr.Elements) == 0 {
+		return newError("array passed to `%s` must not be empty", name)
+	}
+
+	keyOf := func(el object.Object) object.Object {
+		if len(args) == 2 {
+			return ev.applyFunction(args[1], []object.Object{el})
+		}
+		return el
+	}
+	best := arr.Elements[0]
+	bestKey := keyOf(best)
+	if isError(bestKey) {
+		return bestKey
+	}
+	for _, el := range arr.Elements[1:] {
+		if err := ev.cancelled(); err != nil {
+			return err
+		}
+		key := keyOf(el)
+		if isError(key) {
+			return key
+		}
+		comparison, err := compareElements(key, bestKey)
+		if err != nil {
+			return err
+		}
+		if comparison == direction {
+			best, bestKey = el, key
+		}
+	}
+	return best
+}
+
+// Copies the pairs of a hash whose keys are (when keep is true) or aren't (when keep is false) in an array of keys
+// The original hash is left untouched
+func selectKeys(name string, args []object.Object, keep bool) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("first argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+	arr, ok := args[1].(*object.Array)
+	if !ok {
+		return newError("second argument to `%s` must be ARRAY, got %s", name, args[1].Type())
+	}
+
+	selected := map[object.HashKey]bool{}
+	for _, el := range arr.Elements {
+		key, ok := el.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", el.Type())
+		}
+		selected[key.HashKey()] = true
+	}
+
+	pairs := map[object.HashKey]object.HashPair{}
+	for hashKey, pair := range hash.Pairs {
+		if selected[hashKey] == keep {
+			pairs[hashKey] = pair
+		}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+// Calls a function with no arguments n times and returns the total elapsed milliseconds: "bench(fn() { fib(20) }, 10)"
+// Timed with Clock, so tests can stub it
+func (ev *evaluation) bench(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	if !isCallable(args[0]) {
+		return newError("first argument to `bench` must be FUNCTION, got %s", args[0].Type())
+	}
+	n, ok := args[1].(*object.Integer)
+	if !ok {
+		return newError("second argument to `bench` must be INTEGER, got %s", args[1].Type())
+	}
+	if n.Value < 1 {
+		return newError("second argument to `bench` must be positive, got %d", n.Value)
+	}
+
+	start := Clock()
+	for i := int64(0); i < n.Value; i++ {
+		if err := ev.cancelled(); err != nil {
+			return err
+		}
+		result := ev.applyFunction(args[0], []object.Object{})
+		if isError(result) {
+			return result
+		}
+	}
+	return &object.Integer{Value: Clock().Sub(start).Milliseconds()}
+}
+
+// Parses and evaluates a string of Clear source in a fresh environment, returning its result: "eval("1 + 2")" is 3
+// The source counts toward the step limit of the program that called eval, so nested evals can't run forever
+func (ev *evaluation) evalSource(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	source, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `eval` must be STRING, got %s", args[0].Type())
+	}
+	p := parser.New(lexer.New(source.Value))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("could not parse source passed to `eval`: %s", strings.Join(p.Errors(), "; "))
+	}
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	expanded, err := ev.expandMacros(program, env)
+	if err != nil {
+		return newError("%s", err)
+	}
+	// The source is evaluated within the calling evaluation, so it shares its step budget, context and warnings
+	result := ev.eval(expanded, env)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// Returns a hash of the names bound in the calling scope to their values: "let x = 1; locals()" is {x: 1}
+// Only the innermost scope is included, so inside a function that's its parameters and lets, not the globals
+func (ev *evaluation) locals(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	bindings := env.Snapshot()
+	pairs := make(map[object.HashKey]object.HashPair, len(bindings))
+	for name, val := range bindings {
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: val}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+// Looks up a function by name in the calling scope and applies it to the array of arguments: "callByName("add", [1, 2])"
+// Names resolve the same way identifiers do, so builtins can be called by name too
+func (ev *evaluation) callByName(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument to `callByName` must be STRING, got %s", args[0].Type())
+	}
+	arr, ok := args[1].(*object.Array)
+	if !ok {
+		return newError("second argument to `callByName` must be ARRAY, got %s", args[1].Type())
+	}
+	function := ev.evalIdentifier(&ast.Identifier{Value: name.Value}, env)
+	if isError(function) {
+		return function
+	}
+	if !isCallable(function) {
+		return newError("`%s` is not a function, got %s", name.Value, function.Type())
+	}
+	return ev.applyFunction(function, arr.Elements)
+}
+
+// Returns a new array with the elements repeated the given number of times: "repeat([0], 3)"
+func (ev *evaluation) repeat(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `repeat` must be ARRAY, got %s", args[0].Type())
+	}
+	count, ok := args[1].(*object.Integer)
+	if !ok {
+		return newError("second argument to `repeat` must be INTEGER, got %s", args[1].Type())
+	}
+	if count.Value < 0 {
+		return newError("second argument to `repeat` must be non-negative, got %d", count.Value)
+	}
+	// Dividing rather than multiplying keeps the check itself from overflowing
+	length := int64(len(arr.Elements))
+	if length == 0 {
+		return &object.Array{Elements: []object.Object{}}
+	}
+	if count.Value > MaxRepeatLength/length {
+		return newError("result of `repeat` is too large: %d elements repeated %d times, max %d elements", length, count.Value, MaxRepeatLength)
+	}
+	elements := make([]object.Object, 0, length*count.Value)
+	for i := int64(0); i < count.Value; i++ {
+		if err := ev.cancelled(); err != nil {
+			return err
+		}
+		elements = append(elements, arr.Elements...)
+	}
+	return &object.Array{Elements: elements}
+}
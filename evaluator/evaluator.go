@@ -1,10 +1,17 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/ajtroup1/clearv2/ast"
 	"github.com/ajtroup1/clearv2/object"
+	"github.com/ajtroup1/clearv2/token"
 )
 
 var (
@@ -13,97 +20,254 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+// Maximum number of nodes evaluated by a single call to Eval before evaluation stops with an error
+// Protects embeddings running untrusted code from programs that never finish. 0 means unlimited
+var MaxSteps = 0
+
+// Writer the evaluator prints to, such as trace output and the print builtins. Defaults to standard output
+var Out io.Writer = os.Stdout
+
+// When enabled, prints each node's type as it's evaluated to Out, indented by recursion depth
+// Meant for learning how a program is evaluated. Off by default
+var Trace = false
+
+// When enabled, dividing two integers with "/" always gives a float: "5 / 2" is 2.5 rather than 2
+// Floor division ("//") still gives an integer
+var TrueDivision = false
+
+// When enabled, reading an array index that's out of range is an error rather than null
+var IndexOutOfRangeErrors = false
+
+// When enabled, binding a name that shadows a builtin ("let len = 5;") records a warning. Evaluation carries on either way
+var WarnShadowing = false
+
+// Warnings recorded while evaluating the most recent program, published once its evaluation finishes
+// Guarded by warningsMu, since evaluations can run at the same time
+var (
+	warnings   = []string{}
+	warningsMu sync.Mutex
+)
+
+// Returns the warnings recorded while evaluating the most recent program
+func Warnings() []string {
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+	return warnings
+}
+
+// State of a single call to Eval, carried through the evaluation of every node
+// Each call gets its own, so evaluations running at the same time don't share a context, a step budget, warnings or trace indentation
+type evaluation struct {
+	ctx        context.Context // Checked for cancellation while evaluating
+	steps      int             // Number of nodes evaluated so far, checked against MaxSteps
+	warnings   []string        // Warnings recorded so far, published by EvalWithContext when it finishes
+	traceDepth int             // Recursion depth of the node currently being evaluated, used to indent trace output
+}
+
+func newEvaluation(ctx context.Context) *evaluation {
+	return &evaluation{ctx: ctx}
+}
+
+// Returns an error once the evaluation's context is done, or nil while evaluation can carry on
+// Checked on every function call and in the loops of builtins, since those are the only ways a program can run for long
+func (ev *evaluation) cancelled() object.Object {
+	if ev.ctx.Err() != nil {
+		return newError("evaluation cancelled")
+	}
+	return nil
+}
+
 // The core evaluation function. Traverses the AST from the ast.Program down
 // Evaluates the given type of node and returns it as the corresponding evaluated value
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalWithContext(context.Background(), node, env)
+}
+
+// Evaluates the given node like Eval, stopping with an error once ctx is done
+// Lets embeddings cancel long-running programs or give them a deadline
+func EvalWithContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	ev := newEvaluation(ctx)
+	result := ev.eval(node, env)
+	// A statement evaluated on its own can return a deferred call ("return f(4);"), which is made here so callers never see it
+	if returned, ok := result.(*object.ReturnValue); ok {
+		result = &object.ReturnValue{Value: ev.resolveTailCall(returned.Value)}
+	}
+
+	// A program's warnings replace the previous program's, while a single statement's (as the debugger runs) add to them
+	warningsMu.Lock()
+	defer warningsMu.Unlock()
+	if _, ok := node.(*ast.Program); ok {
+		warnings = []string{}
+	}
+	warnings = append(warnings, ev.warnings...)
+	return result
+}
+
+// Evaluates a node within the current evaluation
+func (ev *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
+	if Trace {
+		fmt.Fprintf(Out, "%s%s\n", strings.Repeat("  ", ev.traceDepth), strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+		ev.traceDepth++
+		defer func() { ev.traceDepth-- }()
+	}
+	if MaxSteps > 0 {
+		ev.steps++
+		if ev.steps > MaxSteps {
+			return newError("evaluation limit exceeded")
+		}
+	}
+
 	switch node := node.(type) {
 
 	// Statements
 	case *ast.Program:
-		return evalProgram(node, env)
+		return ev.evalProgram(node, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return ev.evalBlockStatement(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return ev.eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		// Returning a call to a user-defined function is a tail call, which applyFunction can run without growing the stack
+		if call, ok := node.ReturnValue.(*ast.CallExpression); ok {
+			return ev.evalTailCall(call, env)
+		}
+		val := ev.eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		val := ev.eval(node.Value, env)
+		// A return inside a block expression ("let x = { return 5; }") returns from the enclosing function rather than being bound
+		if isError(val) || (val != nil && val.Type() == object.RETURN_VALUE_OBJ) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		ev.warnIfShadowing(node.Name.Value)
+		bind(env, node.Name.Value, val)
+
+	case *ast.DestructuringStatement:
+		return ev.evalDestructuringStatement(node, env)
 
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := ev.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return withPosition(evalPrefixExpression(node.Operator, right), node.Token)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := ev.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		right := ev.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return withPosition(evalInfixExpression(node.Operator, left, right), node.Token)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return ev.evalIfExpression(node, env)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return withPosition(ev.evalIdentifier(node, env), node.Token)
 
-	// case *ast.FunctionLiteral:
-	// 	params := node.Parameters
-	// 	body := node.Body
-	// 	return &object.Function{Parameters: params, Env: env, Body: body}
+	case *ast.FunctionLiteral:
+		params := node.Parameters
+		body := node.Body
+		return &object.Function{Parameters: params, Env: env, Body: body}
 
-	// case *ast.CallExpression:
-	// 	function := Eval(node.Function, env)
-	// 	if isError(function) {
-	// 		return function
-	// 	}
+	case *ast.MacroLiteral:
+		// Macros are bound by DefineMacros before evaluation, so any left in the program weren't defined at the top level
+		return withPosition(newError("macros must be defined with a top-level let statement"), node.Token)
 
-	// 	args := evalExpressions(node.Arguments, env)
-	// 	if len(args) == 1 && isError(args[0]) {
-	// 		return args[0]
-	// 	}
+	case *ast.CallExpression:
+		// quote's argument is returned as code rather than evaluated, so it can't go through applyFunction
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+			if len(node.Arguments) != 1 {
+				return withPosition(newError("wrong number of arguments. got=%d, want=1", len(node.Arguments)), node.Token)
+			}
+			return ev.quote(node.Arguments[0], env)
+		}
 
-	// 	return applyFunction(function, args)
+		function := ev.eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+
+		args := ev.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+
+		return withPosition(ev.applyFunction(function, args), node.Token)
+
+	case *ast.ArrayLiteral:
+		elements := ev.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.IndexExpression:
+		left := ev.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := ev.eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	case *ast.AssignExpression:
+		return ev.evalAssignExpression(node, env)
+
+	case *ast.IncrementExpression:
+		return withPosition(evalIncrementExpression(node, env), node.Token)
+
+	case *ast.HashLiteral:
+		return ev.evalHashLiteral(node, env)
+
+	case *ast.BlockExpression:
+		return ev.evalBlockExpression(node, env)
+
+	case *ast.TemplateStringLiteral:
+		return ev.evalTemplateStringLiteral(node, env)
+
+	case *ast.MethodCallExpression:
+		return ev.evalMethodCallExpression(node, env)
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (ev *evaluation) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = ev.eval(statement, env)
 		switch result := result.(type) {
 		case *object.ReturnValue:
-			return result.Value
+			return ev.resolveTailCall(result.Value)
 		case *object.Error:
 			return result
 		}
@@ -116,7 +280,7 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 // 	var result object.Object
 // 	// Initially, evalute the entire slice of statements in the program
 // 	for _, statement := range stmts {
-// 		result = Eval(statement)
+// 		result = eval(statement)
 // 		if returnValue, ok := result.(*object.ReturnValue); ok {
 // 			return returnValue.Value
 // 		}
@@ -139,6 +303,8 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "+":
+		return evalPlusPrefixOperatorExpression(right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
@@ -154,17 +320,31 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	case NULL:
 		return TRUE
 	default:
-		return FALSE
+		return nativeBoolToBooleanObject(!isTruthy(right)) // Other values are only falsy under ZeroIsFalsy
 	}
 }
 
 // Evaluates the native negaitve prefix operator to the right expression operand
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+}
+
+// Evaluates the plus prefix operator to the right expression operand
+// It leaves numbers unchanged, and exists for symmetry with the minus prefix: "+5"
+func evalPlusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right.(type) {
+	case *object.Integer, *object.Float:
+		return right
+	default:
+		return newError("unknown operator: +%s", right.Type())
+	}
 }
 
 func evalInfixExpression(
@@ -174,6 +354,20 @@ func evalInfixExpression(
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// Mixing integers & floats promotes both operands to floats
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ && operator == "+":
+		return evalArrayConcatenation(left, right)
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ && isOrderingOperator(operator):
+		return evalArrayComparison(operator, left, right)
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ && operator != "==" && operator != "!=":
+		// Arrays only support + and ordering, so any other arithmetic between them is reported like mismatched operands
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case left.Type() == object.HASH_OBJ && right.Type() == object.HASH_OBJ && operator == "+":
+		return evalHashMerge(left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -200,11 +394,31 @@ func evalIntegerInfixExpression(
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if TrueDivision {
+			return &object.Float{Value: float64(leftVal) / float64(rightVal)}
+		}
+		if rightVal == 0 {
+			return newError("division by zero: %d / 0", leftVal)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "//":
+		if rightVal == 0 {
+			return newError("division by zero: %d // 0", leftVal)
+		}
+		// Go's division truncates toward zero, so results with a remainder and mixed signs are one too high: -7 // 2 is -4, not -3
+		quotient := leftVal / rightVal
+		if leftVal%rightVal != 0 && (leftVal < 0) != (rightVal < 0) {
+			quotient--
+		}
+		return &object.Integer{Value: quotient}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -215,20 +429,238 @@ func evalIntegerInfixExpression(
 	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "//":
+		// Matches integer floor division, rather than giving an infinity like "/" does
+		if rightVal == 0 {
+			return newError("division by zero: %s // %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: math.Floor(leftVal / rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// Reports whether the object is an integer or a float
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// Converts an integer or float object to a native float
+func toFloat(obj object.Object) float64 {
+	if integer, ok := obj.(*object.Integer); ok {
+		return float64(integer.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// Concatenates two arrays into a new array, leaving both operands untouched
+func evalArrayConcatenation(left, right object.Object) object.Object {
+	leftElements := left.(*object.Array).Elements
+	rightElements := right.(*object.Array).Elements
+
+	elements := make([]object.Object, 0, len(leftElements)+len(rightElements))
+	elements = append(elements, leftElements...)
+	elements = append(elements, rightElements...)
+
+	return &object.Array{Elements: elements}
+}
+
+// Reports whether the operator orders its operands: "<", ">", "<=" or ">="
+func isOrderingOperator(operator string) bool {
+	return operator == "<" || operator == ">" || operator == "<=" || operator == ">="
+}
+
+// Compares two arrays lexicographically: "[1, 2] < [1, 3]"
+// Elements are compared pairwise until they differ. When one array is a prefix of the other, the shorter one is less
+func evalArrayComparison(operator string, left, right object.Object) object.Object {
+	comparison, err := compareArrays(left.(*object.Array), right.(*object.Array))
+	if err != nil {
+		return err
+	}
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(comparison < 0)
+	case ">":
+		return nativeBoolToBooleanObject(comparison > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(comparison <= 0)
+	default:
+		return nativeBoolToBooleanObject(comparison >= 0)
+	}
+}
+
+// Returns -1, 0 or 1 as the left array orders before, the same as, or after the right array
+// Returns an error when a pair of elements can't be ordered
+func compareArrays(left, right *object.Array) (int, *object.Error) {
+	for i := 0; i < len(left.Elements) && i < len(right.Elements); i++ {
+		comparison, err := compareElements(left.Elements[i], right.Elements[i])
+		if err != nil {
+			return 0, err
+		}
+		if comparison != 0 {
+			return comparison, nil
+		}
+	}
+	switch {
+	case len(left.Elements) < len(right.Elements):
+		return -1, nil
+	case len(left.Elements) > len(right.Elements):
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// Orders a pair of array elements. Numbers, strings & nested arrays can be ordered against their own kind
+func compareElements(left, right object.Object) (int, *object.Error) {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		leftVal, rightVal := left.(*object.Integer).Value, right.(*object.Integer).Value
+		if leftVal < rightVal {
+			return -1, nil
+		} else if leftVal > rightVal {
+			return 1, nil
+		}
+		return 0, nil
+	case isNumber(left) && isNumber(right):
+		leftVal, rightVal := toFloat(left), toFloat(right)
+		if leftVal < rightVal {
+			return -1, nil
+		} else if leftVal > rightVal {
+			return 1, nil
+		}
+		return 0, nil
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return strings.Compare(left.(*object.String).Value, right.(*object.String).Value), nil
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		return compareArrays(left.(*object.Array), right.(*object.Array))
+	default:
+		return 0, newError("cannot order array elements: %s and %s", left.Type(), right.Type())
+	}
+}
+
+// Binds each name to the array element at the same position
+// Names past the end of the array are bound to null, and elements past the last name are ignored
+func (ev *evaluation) evalDestructuringStatement(ds *ast.DestructuringStatement, env *object.Environment) object.Object {
+	val := ev.eval(ds.Value, env)
+	// As with let, a return inside a block expression returns from the enclosing function
+	if isError(val) || (val != nil && val.Type() == object.RETURN_VALUE_OBJ) {
+		return val
+	}
+	// Code that gives no value, like a function whose body is empty, is destructured as null
+	if val == nil {
+		val = NULL
+	}
+	arr, ok := val.(*object.Array)
+	if !ok {
+		return newError("cannot destructure %s, expected ARRAY", val.Type())
+	}
+	for i, name := range ds.Names {
+		var element object.Object = NULL
+		if i < len(arr.Elements) {
+			element = arr.Elements[i]
+		}
+		ev.warnIfShadowing(name.Value)
+		bind(env, name.Value, element)
+	}
+	return nil
+}
+
+// Binds a name to a value in the environment, unless the name is "_"
+// "_" is a throwaway name, so it can be bound any number of times and is never visible
+func bind(env *object.Environment, name string, val object.Object) {
+	if name != "_" {
+		env.Set(name, val)
+	}
+}
+
+// Records a warning when WarnShadowing is on and a let statement binds the name of a builtin
+func (ev *evaluation) warnIfShadowing(name string) {
+	_, isBuiltin := builtins[name]
+	_, isEvalBuiltin := evalBuiltins[name]
+	_, isEnvBuiltin := envBuiltins[name]
+	if (isBuiltin || isEvalBuiltin || isEnvBuiltin) && WarnShadowing {
+		ev.warnings = append(ev.warnings, fmt.Sprintf("warning: %s shadows a builtin function", name))
+	}
+}
+
+// Merges two hashes into a new hash, leaving both operands untouched
+// When both hashes contain the same key, the value from the right hash wins
+func evalHashMerge(left, right object.Object) object.Object {
+	leftPairs := left.(*object.Hash).Pairs
+	rightPairs := right.(*object.Hash).Pairs
+
+	pairs := make(map[object.HashKey]object.HashPair, len(leftPairs)+len(rightPairs))
+	for key, pair := range leftPairs {
+		pairs[key] = pair
+	}
+	for key, pair := range rightPairs {
+		pairs[key] = pair
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// Evaluates infix operators between two strings. Only concatenation is supported
+func evalStringInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	if operator != "+" {
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+	return &object.String{Value: leftVal + rightVal}
+}
+
+func (ev *evaluation) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := ev.eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return ev.eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return ev.eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+// Whether zero, the empty string and the empty array are falsy, like in Python and JavaScript
+// Off by default, so only null and false are falsy
+var ZeroIsFalsy = false
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -237,15 +669,26 @@ func isTruthy(obj object.Object) bool {
 		return true
 	case FALSE:
 		return false
-	default:
-		return true
 	}
+	if ZeroIsFalsy {
+		switch obj := obj.(type) {
+		case *object.Integer:
+			return obj.Value != 0
+		case *object.Float:
+			return obj.Value != 0
+		case *object.String:
+			return obj.Value != ""
+		case *object.Array:
+			return len(obj.Elements) != 0
+		}
+	}
+	return true
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (ev *evaluation) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = ev.eval(statement, env)
 		if result != nil {
 			rt := result.Type()
 			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
@@ -256,16 +699,415 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalIdentifier(
+// Evaluates a string with embedded expressions by joining its literal text with the values of its expressions
+// Strings are embedded as they are, and other values as they're displayed
+func (ev *evaluation) evalTemplateStringLiteral(tl *ast.TemplateStringLiteral, env *object.Environment) object.Object {
+	var out strings.Builder
+	for _, part := range tl.Parts {
+		value := ev.eval(part, env)
+		if isError(value) {
+			return value
+		}
+		if str, ok := value.(*object.String); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString(value.Inspect())
+		}
+	}
+	return &object.String{Value: out.String()}
+}
+
+// Evaluates a block used as an expression to the value of its last statement
+// The block gets its own scope, so its let bindings don't leak out of it
+func (ev *evaluation) evalBlockExpression(be *ast.BlockExpression, env *object.Environment) object.Object {
+	result := ev.evalBlockStatement(be.Block, object.NewEnclosedEnvironment(env))
+	if result == nil { // A block ending in a let statement has no value
+		return NULL
+	}
+	return result
+}
+
+func (ev *evaluation) evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
 ) object.Object {
-	val, ok := env.Get(node.Value)
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	// Fall back to the builtin functions if the environment doesn't define the name
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+	if fn, ok := evalBuiltins[node.Value]; ok {
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object { return fn(ev, args...) }}
+	}
+	if fn, ok := envBuiltins[node.Value]; ok {
+		return &object.Builtin{Fn: func(args ...object.Object) object.Object { return fn(ev, env, args...) }}
+	}
+
+	return newError("identifier not found: " + node.Value)
+}
+
+// Evaluates accessing an element of an indexable object
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// Returns the element at the given index, or null if the index is out of range
+// Out of range indexes are an error instead when IndexOutOfRangeErrors is on
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if idx < 0 || idx > max {
+		if IndexOutOfRangeErrors {
+			return newError("index out of range: %d", idx)
+		}
+		return NULL
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+// Adds or subtracts one from a variable and stores the result in the scope that defines it
+// Prefix forms return the updated value, postfix forms the original one
+func evalIncrementExpression(node *ast.IncrementExpression, env *object.Environment) object.Object {
+	current, ok := env.Get(node.Name.Value)
+	if !ok {
+		return newError("identifier not found: " + node.Name.Value)
+	}
+
+	delta := int64(1)
+	if node.Operator == "--" {
+		delta = -1
+	}
+	var updated object.Object
+	switch current := current.(type) {
+	case *object.Integer:
+		updated = &object.Integer{Value: current.Value + delta}
+	case *object.Float:
+		updated = &object.Float{Value: current.Value + float64(delta)}
+	default:
+		if node.Prefix {
+			return newError("unknown operator: %s%s", node.Operator, current.Type())
+		}
+		return newError("unknown operator: %s%s", current.Type(), node.Operator)
+	}
+
+	env.Assign(node.Name.Value, updated)
+	if node.Prefix {
+		return updated
+	}
+	return current
+}
+
+// Stores a value in a variable, or in an element of an array or hash in place, returning the value
+func (ev *evaluation) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	if name, ok := node.Target.(*ast.Identifier); ok {
+		return ev.evalVariableAssignment(name, node.Value, env)
+	}
+	return ev.evalIndexAssignment(node.Target.(*ast.IndexExpression), node.Value, env) // The parser only allows identifier & index targets
+}
+
+// Rebinds an existing variable in the scope that defines it, so functions can update variables they close over
+// Assigning to a name that was never bound with let is an error
+func (ev *evaluation) evalVariableAssignment(name *ast.Identifier, valueNode ast.Expression, env *object.Environment) object.Object {
+	if _, ok := env.Get(name.Value); !ok {
+		return newError("identifier not found: " + name.Value)
+	}
+	value := ev.eval(valueNode, env)
+	if isError(value) {
+		return value
+	}
+	env.Assign(name.Value, value)
+	return value
+}
+
+// Stores a value in an element of an array or hash in place
+// Unlike reads, assigning outside an array's bounds is an error rather than null, since there's no element to update
+func (ev *evaluation) evalIndexAssignment(target *ast.IndexExpression, valueNode ast.Expression, env *object.Environment) object.Object {
+	left := ev.eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+	index := ev.eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+	value := ev.eval(valueNode, env)
+	if isError(value) {
+		return value
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", idx.Value)
+		}
+		left.Elements[idx.Value] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+	return value
+}
+
+// Returns the value stored under the given key, or null if the hash doesn't contain it
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
-		return newError("identifier not found: " + node.Value)
+		return NULL
+	}
+
+	return pair.Value
+}
+
+// Evaluates each key-value pair of a hash literal into a hash
+func (ev *evaluation) evalHashLiteral(
+	node *ast.HashLiteral,
+	env *object.Environment,
+) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for keyNode, valueNode := range node.Pairs {
+		key := ev.eval(keyNode, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := ev.eval(valueNode, env)
+		if isError(value) {
+			return value
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// Evaluates a method call by calling the builtin of the same name with the receiver as the first argument
+// "hello".upper() is evaluated as upper("hello")
+func (ev *evaluation) evalMethodCallExpression(
+	node *ast.MethodCallExpression,
+	env *object.Environment,
+) object.Object {
+	receiver := ev.eval(node.Receiver, env)
+	if isError(receiver) {
+		return receiver
+	}
+
+	builtin, ok := lookupMethod(node.Method.Value)
+	if !ok {
+		return newError("unknown method: %s.%s", receiver.Type(), node.Method.Value)
+	}
+
+	args := ev.evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	return ev.applyFunction(builtin, append([]object.Object{receiver}, args...))
+}
+
+// Evaluates a list of expressions left to right, stopping at the first error
+func (ev *evaluation) evalExpressions(
+	exps []ast.Expression,
+	env *object.Environment,
+) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := ev.eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// Calls a user-defined or builtin function with the evaluated arguments
+func (ev *evaluation) applyFunction(fn object.Object, args []object.Object) object.Object {
+	switch fn := fn.(type) {
+
+	case *object.Function:
+		for {
+			// Checked on every call, including each iteration of a tail call, since a program can only run forever by recursing
+			if err := ev.cancelled(); err != nil {
+				return err
+			}
+			if len(args) != len(fn.Parameters) {
+				return newError("wrong number of arguments. got=%d, want=%d",
+					len(args), len(fn.Parameters))
+			}
+			extendedEnv := extendFunctionEnv(fn, args)
+			evaluated := unwrapReturnValue(ev.eval(fn.Body, extendedEnv))
+
+			// A function returning a call to itself reuses this loop instead of recursing, so deep tail recursion doesn't overflow the stack
+			if call, ok := evaluated.(*tailCall); ok && call.fn == fn {
+				args = call.args
+				continue
+			}
+			return ev.resolveTailCall(evaluated)
+		}
+
+	case *object.Builtin:
+		return fn.Fn(args...)
+
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+// A call in tail position ("return f(x);") that hasn't been applied yet
+// Only exists while a return value is on its way out of a function body, and never escapes the evaluator
+type tailCall struct {
+	fn   *object.Function
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// Evaluates "return f(x);"
+// Calls to user-defined functions are deferred as a tailCall so applyFunction can decide how to run them. Anything else is called right away
+func (ev *evaluation) evalTailCall(call *ast.CallExpression, env *object.Environment) object.Object {
+	function := ev.eval(call.Function, env)
+	if isError(function) {
+		return function
+	}
+
+	args := ev.evalExpressions(call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	if fn, ok := function.(*object.Function); ok {
+		return &object.ReturnValue{Value: &tailCall{fn: fn, args: args}}
+	}
+
+	val := ev.applyFunction(function, args)
+	if isError(val) {
+		return val
+	}
+	return &object.ReturnValue{Value: val}
+}
+
+// Applies a deferred tail call that wasn't a call back into the same function, as an ordinary call
+func (ev *evaluation) resolveTailCall(obj object.Object) object.Object {
+	if call, ok := obj.(*tailCall); ok {
+		return ev.applyFunction(call.fn, call.args)
+	}
+	return obj
+}
+
+// Binds the arguments to the function's parameters in a new environment enclosed by the one the function was defined in
+func extendFunctionEnv(
+	fn *object.Function,
+	args []object.Object,
+) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	for paramIdx, param := range fn.Parameters {
+		bind(env, param.Value, args[paramIdx])
+	}
+
+	return env
+}
+
+// Unwraps a return value so that a return inside a function doesn't stop evaluation of the caller
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
+// Reports whether two objects hold the same value
+// Integers, booleans & strings compare by value, arrays & hashes compare their contents recursively, and anything else (functions...) compares by identity
+func objectsEqual(a, b object.Object) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a := a.(type) {
+	case *object.Integer:
+		return a.Value == b.(*object.Integer).Value
+	case *object.Float:
+		return a.Value == b.(*object.Float).Value
+	case *object.Boolean:
+		return a.Value == b.(*object.Boolean).Value
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Null:
+		return true
+	case *object.Array:
+		other := b.(*object.Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i, el := range a.Elements {
+			if !objectsEqual(el, other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		other := b.(*object.Hash)
+		if len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok || !objectsEqual(pair.Value, otherPair.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
 	}
+}
 
-	return val
+// Records the token's position on an error that doesn't have one yet, so the error points at the code that caused it
+// Errors keep the innermost position as they propagate, since that's the most precise
+func withPosition(obj object.Object, tok token.Token) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Line == 0 {
+		err.Line, err.Column, err.Source = tok.Line, tok.Column, tok.Source
+	}
+	return obj
 }
 
 func newError(format string, a ...interface{}) *object.Error {
@@ -279,3 +1121,143 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// Wraps the node in a Quote without evaluating it, first splicing in the values of any "unquote(x)" calls inside it
+// Splicing works on a copy, since the node belongs to the program (or macro body) and may be quoted again
+func (ev *evaluation) quote(node ast.Node, env *object.Environment) object.Object {
+	node, unquoteErr := ev.evalUnquoteCalls(ast.Copy(node), env)
+	if unquoteErr != nil {
+		return unquoteErr
+	}
+	return &object.Quote{Node: node}
+}
+
+// Replaces each "unquote(x)" call in the quoted node with the AST form of x's evaluated value
+// Returns the first error an unquoted expression evaluates to, leaving the rest of the calls alone
+func (ev *evaluation) evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var unquoteErr *object.Error
+	modified := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || len(call.Arguments) != 1 || unquoteErr != nil {
+			return node
+		}
+		if ident, ok := call.Function.(*ast.Identifier); !ok || ident.Value != "unquote" {
+			return node
+		}
+		value := ev.eval(call.Arguments[0], env)
+		if err, ok := value.(*object.Error); ok {
+			unquoteErr = err
+			return node
+		}
+		return convertObjectToASTNode(value, node)
+	})
+	return modified, unquoteErr
+}
+
+// Converts an evaluated value back into code that evaluates to it
+// Values with no literal form, such as functions, leave the original node in place
+func convertObjectToASTNode(obj object.Object, original ast.Node) ast.Node {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value)}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+	case *object.Float:
+		t := token.Token{Type: token.FLOAT, Literal: obj.Inspect()}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false"}
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}
+	case *object.Quote:
+		return obj.Node
+	default:
+		return original
+	}
+}
+
+// Binds each top-level "let name = macro(...)" in the program in env and removes it from the program
+// Run before ExpandMacros, so macros can be called anywhere in the program regardless of where they're defined
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := []ast.Statement{}
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+		macro, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, statement)
+			continue
+		}
+		env.Set(let.Name.Value, &object.Macro{Parameters: macro.Parameters, Body: macro.Body, Env: env})
+	}
+	program.Statements = statements
+}
+
+// Replaces each call to a macro defined in env with the code the macro returns
+// The macro's arguments are passed to it as quoted code, and it must return quoted code: "quote(...)"
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	return newEvaluation(context.Background()).expandMacros(program, env)
+}
+
+// Expands macros like ExpandMacros, evaluating the macros within an evaluation that's already running, such as the eval builtin's
+func (ev *evaluation) expandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var expandErr error
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || expandErr != nil {
+			return node
+		}
+		macro, ok := macroForCall(call, env)
+		if !ok {
+			return node
+		}
+		if len(call.Arguments) != len(macro.Parameters) {
+			expandErr = fmt.Errorf("wrong number of arguments to macro. got=%d, want=%d", len(call.Arguments), len(macro.Parameters))
+			return node
+		}
+
+		macroEnv := object.NewEnclosedEnvironment(macro.Env)
+		for i, param := range macro.Parameters {
+			macroEnv.Set(param.Value, &object.Quote{Node: call.Arguments[i]})
+		}
+		evaluated := ev.eval(macro.Body, macroEnv)
+		// As at the top of a program, a returned call ("return mk(x);") is deferred and has to be made here
+		if returned, ok := evaluated.(*object.ReturnValue); ok {
+			evaluated = ev.resolveTailCall(returned.Value)
+		}
+		if evaluated == nil {
+			evaluated = NULL
+		}
+		if err, ok := evaluated.(*object.Error); ok {
+			expandErr = fmt.Errorf("%s", err.Message)
+			return node
+		}
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			expandErr = fmt.Errorf("macro must return QUOTE, got %s", evaluated.Type())
+			return node
+		}
+		return quote.Node
+	})
+	return expanded, expandErr
+}
+
+// Looks up the macro a call expression calls, if its function is the name of one
+func macroForCall(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
@@ -1,8 +1,17 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ajtroup1/clearv2/ast"
 	"github.com/ajtroup1/clearv2/lexer"
 	"github.com/ajtroup1/clearv2/object"
 	"github.com/ajtroup1/clearv2/parser"
@@ -89,6 +98,10 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -180,6 +193,20 @@ func TestIfElseExpressions(t *testing.T) {
 		}
 	}
 }
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			expected, errObj.Message)
+		return false
+	}
+	return true
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
@@ -289,3 +316,3073 @@ func TestLetStatements(t *testing.T) {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
 	}
 }
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+	let newAdder = fn(x) {
+	fn(y) { x + y };
+	};
+	let addTwo = newAdder(2);
+	addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestNowBuiltin(t *testing.T) {
+	original := Clock
+	defer func() { Clock = original }()
+	Clock = func() time.Time { return time.UnixMilli(1700000000123) }
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"now()", 1700000000123},
+		{"now() - now()", 0},
+		{"now(1)", "wrong number of arguments. got=1, want=0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestSleepBuiltin(t *testing.T) {
+	original := Sleep
+	defer func() { Sleep = original }()
+
+	var slept []time.Duration
+	Sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	evaluated := testEval("sleep(250)")
+	testNullObject(t, evaluated)
+	if len(slept) != 1 || slept[0] != 250*time.Millisecond {
+		t.Errorf("sleep called with wrong durations. got=%v", slept)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sleep()", "wrong number of arguments. got=0, want=1"},
+		{"sleep(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"sleep(true)", "argument to `sleep` must be INTEGER, got BOOLEAN"},
+		{"sleep(-1)", "argument to `sleep` must be non-negative, got -1"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+	if len(slept) != 1 {
+		t.Errorf("sleep should not be called for invalid arguments. got=%v", slept)
+	}
+}
+
+func TestRandBuiltin(t *testing.T) {
+	testNullObject(t, testEval("seed(42)"))
+
+	expected := rand.New(rand.NewSource(42))
+	for i := 0; i < 5; i++ {
+		testIntegerObject(t, testEval("rand(100)"), expected.Int63n(100))
+	}
+
+	// Reseeding with the same value reproduces the same sequence
+	testEval("seed(42)")
+	first := testEval("rand(1000)")
+	testEval("seed(42)")
+	second := testEval("rand(1000)")
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("reseeding did not reproduce the sequence. got=%s, then %s",
+			first.Inspect(), second.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"rand()", "wrong number of arguments. got=0, want=1"},
+		{"rand(true)", "argument to `rand` must be INTEGER, got BOOLEAN"},
+		{"rand(0)", "argument to `rand` must be positive, got 0"},
+		{"seed(false)", "argument to `seed` must be INTEGER, got BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d",
+			len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestArrayConcatenation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2] + [3, 4]", "[1, 2, 3, 4]"},
+		{"[] + [1]", "[1]"},
+		{"[1] + []", "[1]"},
+		{"[] + []", "[]"},
+		{"[1] + [2] + [3]", "[1, 2, 3]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong concatenation. expected=%s, got=%s",
+				tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// Neither operand is modified by the concatenation
+	input := "let a = [1, 2]; let b = [3, 4]; let c = a + b; [a, b, c]"
+	evaluated := testEval(input)
+	if evaluated.Inspect() != "[[1, 2], [3, 4], [1, 2, 3, 4]]" {
+		t.Errorf("operands were mutated. got=%s", evaluated.Inspect())
+	}
+
+	testErrorObject(t, testEval("[1] + 1"), "type mismatch: ARRAY + INTEGER")
+	testErrorObject(t, testEval("[1] - [1]"), "type mismatch: ARRAY - ARRAY")
+	testErrorObject(t, testEval("[1] * [2]"), "type mismatch: ARRAY * ARRAY")
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+
+	testErrorObject(t, testEval(`"Hello" - "World"`), "unknown operator: STRING - STRING")
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+	"one": 10 - 9,
+	two: 1 + 1,
+	"thr" + "ee": 6 / 2,
+	4: 4,
+	true: 5,
+	false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashMerge(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// Disjoint keys keep every pair
+		{`({"a": 1} + {"b": 2})["a"]`, 1},
+		{`({"a": 1} + {"b": 2})["b"]`, 2},
+		// On a collision the right-hand value wins
+		{`({"a": 1, "b": 2} + {"a": 3})["a"]`, 3},
+		{`({"a": 1, "b": 2} + {"a": 3})["b"]`, 2},
+		{`({} + {})["a"]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	// Neither operand is modified by the merge
+	input := `let a = {"a": 1}; let b = {"a": 2, "b": 3}; let c = a + b; [a["a"], a["b"], b["a"], c["a"], c["b"]]`
+	evaluated := testEval(input)
+	if evaluated.Inspect() != "[1, null, 2, 2, 3]" {
+		t.Errorf("operands were mutated. got=%s", evaluated.Inspect())
+	}
+
+	testErrorObject(t, testEval(`{"a": 1} + 1`), "type mismatch: HASH + INTEGER")
+	testErrorObject(t, testEval(`{"a": 1} - {"a": 1}`), "unknown operator: HASH - HASH")
+}
+
+func TestBoolBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"bool(true)", true},
+		{"bool(false)", false},
+		{"bool(if (false) { 1 })", false},
+		{"bool(1)", true},
+		// Integers are truthy even when zero, matching conditionals
+		{"bool(0)", true},
+		{"bool(-1)", true},
+		{`bool("")`, true},
+		{`bool("text")`, true},
+		{"bool([])", true},
+		{"bool({})", true},
+		{"bool(fn() { 1 })", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// The shared singletons are returned so identity comparisons keep working
+	if testEval("bool(1)") != TRUE || testEval("bool(false)") != FALSE {
+		t.Errorf("bool did not return the shared TRUE/FALSE objects")
+	}
+
+	testErrorObject(t, testEval("bool()"), "wrong number of arguments. got=0, want=1")
+	testErrorObject(t, testEval("bool(1, 2)"), "wrong number of arguments. got=2, want=1")
+}
+
+func TestLenBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello".len()`, 5},
+		{`let s = "hi"; s.len()`, 2},
+		{`[1, 2, 3].len()`, 3},
+		{`"ab".len() + "cd".len()`, 4},
+		{`"hello".shout()`, "unknown method: STRING.shout"},
+		{`"hello".now()`, "unknown method: STRING.now"},
+		{`"hello".len(1)`, "wrong number of arguments. got=2, want=1"},
+		{`5.len()`, "argument to `len` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestUpperLowerBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`upper("abc")`, "ABC"},
+		{`upper("Hello, World!")`, "HELLO, WORLD!"},
+		{`upper("")`, ""},
+		{`lower("ABC")`, "abc"},
+		{`lower("Hello, World!")`, "hello, world!"},
+		{`"abc".upper()`, "ABC"},
+		{`"ABC".lower()`, "abc"},
+		{`"MiXeD".lower().upper()`, "MIXED"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`upper(1)`, "argument to `upper` must be STRING, got INTEGER"},
+		{`lower([1])`, "argument to `lower` must be STRING, got ARRAY"},
+		{`upper()`, "wrong number of arguments. got=0, want=1"},
+		{`lower("a", "b")`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestTrimBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`trim("  hi  ")`, "hi"},
+		{"trim(\"\t hi \n\")", "hi"},
+		{`trim("hi")`, "hi"},
+		{`trim("   ")`, ""},
+		{`trimLeft("  hi  ")`, "hi  "},
+		{`trimRight("  hi  ")`, "  hi"},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`trim("-=hi=-", "=-")`, "hi"},
+		{`trimLeft("xxhixx", "x")`, "hixx"},
+		{`trimRight("xxhixx", "x")`, "xxhi"},
+		{`trim("  hi  ", "x")`, "  hi  "},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`trim(1)`, "argument to `trim` must be STRING, got INTEGER"},
+		{`trimLeft(true)`, "argument to `trimLeft` must be STRING, got BOOLEAN"},
+		{`trimRight("hi", 1)`, "cutset argument to `trimRight` must be STRING, got INTEGER"},
+		{`trim()`, "wrong number of arguments. got=0, want=1 or 2"},
+		{`trim("a", "b", "c")`, "wrong number of arguments. got=3, want=1 or 2"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIndexOfBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`indexOf("hello", "ll")`, 2},
+		{`indexOf("hello", "h")`, 0},
+		{`indexOf("hello", "")`, 0},
+		{`indexOf("hello", "z")`, -1},
+		// Positions are counted in bytes, like len, so "é" counts as two
+		{`indexOf("héllo", "llo")`, 3},
+		{`len("hé") == indexOf("héllo", "llo")`, true},
+		{`indexOf([1, 2, 3], 2)`, 1},
+		{`indexOf([1, 2, 3], 4)`, -1},
+		{`indexOf([], 1)`, -1},
+		{`indexOf(["a", "b"], "b")`, 1},
+		{`indexOf([[1], [2]], [2])`, 1},
+		{`indexOf([1, "1"], "1")`, 1},
+		{`indexOf(1, 1)`, "argument to `indexOf` not supported, got INTEGER"},
+		{`indexOf("abc", 1)`, "argument to `indexOf` must be STRING when searching a STRING, got INTEGER"},
+		{`indexOf("abc")`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestStartsWithEndsWithBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`startsWith("filename.clr", "file")`, true},
+		{`startsWith("filename.clr", "name")`, false},
+		{`startsWith("filename.clr", "")`, true},
+		{`startsWith("", "a")`, false},
+		{`endsWith("filename.clr", ".clr")`, true},
+		{`endsWith("filename.clr", ".go")`, false},
+		{`endsWith("filename.clr", "")`, true},
+		{`startsWith("abc", 1)`, "arguments to `startsWith` must be STRING, got INTEGER"},
+		{`endsWith([1], "a")`, "arguments to `endsWith` must be STRING, got ARRAY"},
+		{`startsWith("abc")`, "wrong number of arguments. got=1, want=2"},
+		{`endsWith("a", "b", "c")`, "wrong number of arguments. got=3, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"5 / 2.0", 2.5},
+		{"2 * 1.25", 2.5},
+		{"10.0 - 0.5 * 2", 9.0},
+	}
+
+	for _, tt := range tests {
+		testFloatObject(t, testEval(tt.input), tt.expected)
+	}
+
+	boolTests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"1.5 > 2", false},
+		{"2.0 == 2", true},
+		{"2.5 != 2.5", false},
+	}
+
+	for _, tt := range boolTests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	if got := testEval("1.0 + 2").Inspect(); got != "3.0" {
+		t.Errorf("wrong float output. expected=%q, got=%q", "3.0", got)
+	}
+	testErrorObject(t, testEval("1.5 + true"), "type mismatch: FLOAT + BOOLEAN")
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%f, want=%f",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestCountBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`count("banana", "a")`, 3},
+		{`count("banana", "an")`, 2},
+		{`count("banana", "z")`, 0},
+		// Overlapping matches aren't counted twice
+		{`count("aaaa", "aa")`, 2},
+		{`count([1, 2, 2, 3], 2)`, 2},
+		{`count([1, 2, 2, 3], 4)`, 0},
+		{`count([], 1)`, 0},
+		{`count(["a", "b", "a"], "a")`, 2},
+		{`count([[1], [1], 1], [1])`, 2},
+		{`count(1, 1)`, "argument to `count` not supported, got INTEGER"},
+		{`count("abc", 1)`, "argument to `count` must be STRING when searching a STRING, got INTEGER"},
+		{`count([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestRepeatBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat([0], 3)`, "[0, 0, 0]"},
+		{`repeat([1, 2], 2)`, "[1, 2, 1, 2]"},
+		{`repeat([1, 2], 1)`, "[1, 2]"},
+		{`repeat([1, 2], 0)`, "[]"},
+		{`repeat([], 5)`, "[]"},
+		{`repeat([], 9223372036854775807)`, "[]"},
+		{`let a = [1]; repeat(a, 2); a`, "[1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if _, ok := evaluated.(*object.Array); !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%s, got=%s",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat([1], -1)`, "second argument to `repeat` must be non-negative, got -1"},
+		{`repeat("a", 2)`, "first argument to `repeat` must be ARRAY, got STRING"},
+		{`repeat([1], "2")`, "second argument to `repeat` must be INTEGER, got STRING"},
+		{`repeat([1])`, "wrong number of arguments. got=1, want=2"},
+		{`repeat([1, 2], 9223372036854775807)`, "result of `repeat` is too large: 2 elements repeated 9223372036854775807 times, max 16777216 elements"},
+		{`repeat([1], 16777217)`, "result of `repeat` is too large: 1 elements repeated 16777217 times, max 16777216 elements"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEntriesFromEntriesBuiltins(t *testing.T) {
+	// entries returns each pair as a [key, value] array
+	evaluated := testEval(`entries({"a": 1})`)
+	if evaluated.Inspect() != `[[a, 1]]` {
+		t.Errorf("wrong entries. got=%s", evaluated.Inspect())
+	}
+	testIntegerObject(t, testEval(`len(entries({"a": 1, "b": 2, 3: 4}))`), 3)
+	testIntegerObject(t, testEval(`len(entries({}))`), 0)
+
+	// A hash survives a round trip through entries and fromEntries
+	input := `let h = {"a": 1, "b": [2], true: "c"}; fromEntries(entries(h))`
+	roundTripped, ok := testEval(input).(*object.Hash)
+	if !ok {
+		t.Fatalf("fromEntries didn't return Hash. got=%T", testEval(input))
+	}
+	original := testEval(`{"a": 1, "b": [2], true: "c"}`)
+	if !objectsEqual(roundTripped, original) {
+		t.Errorf("round trip changed the hash. expected=%s, got=%s",
+			original.Inspect(), roundTripped.Inspect())
+	}
+
+	// Later entries win when keys repeat
+	testIntegerObject(t, testEval(`fromEntries([["a", 1], ["a", 2]])["a"]`), 2)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`entries([1])`, "argument to `entries` must be HASH, got ARRAY"},
+		{`fromEntries({})`, "argument to `fromEntries` must be ARRAY, got HASH"},
+		{`fromEntries([1])`, "entry 0 passed to `fromEntries` must be a [key, value] ARRAY, got 1"},
+		{`fromEntries([["a", 1], ["b"]])`, "entry 1 passed to `fromEntries` must be a [key, value] ARRAY, got [b]"},
+		{`fromEntries([[[1], 1]])`, "unusable as hash key: ARRAY"},
+		{`entries()`, "wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNestedFunctionsCaptureOuterLocals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// The inner function sees the outer function's parameter after the outer call has returned
+		{`
+		let outer = fn(x) {
+		let inner = fn(y) { x + y };
+		inner
+		};
+		let addFive = outer(5);
+		addFive(10);`, 15},
+		// And the outer function's locals, including ones bound before the inner function is defined
+		{`
+		let outer = fn(x) {
+		let doubled = x * 2;
+		let inner = fn() { doubled + x };
+		return inner;
+		};
+		outer(3)();`, 9},
+		// Helpers defined inside a function can call each other
+		{`
+		let outer = fn(n) {
+		let square = fn(x) { x * x };
+		let sumSquares = fn(a, b) { square(a) + square(b) };
+		sumSquares(n, n + 1)
+		};
+		outer(2);`, 13},
+		// Each call of the outer function captures its own bindings
+		{`
+		let makeAdder = fn(x) { fn(y) { x + y } };
+		let addOne = makeAdder(1);
+		let addTen = makeAdder(10);
+		addOne(1) + addTen(1);`, 13},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTailCallOptimization(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// Deep enough to overflow the stack if every call recursed
+		{`
+		let countDown = fn(n) {
+		if (n == 0) { return 0; }
+		return countDown(n - 1);
+		};
+		countDown(1000000);`, 0},
+		{`
+		let sum = fn(n, acc) {
+		if (n == 0) { return acc; }
+		return sum(n - 1, acc + n);
+		};
+		sum(1000000, 0);`, 500000500000},
+		// Non-tail recursion still works as before
+		{`
+		let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } };
+		fact(10);`, 3628800},
+		// Tail calls to other functions are ordinary calls
+		{`
+		let double = fn(x) { x * 2 };
+		let f = fn(x) { return double(x + 1); };
+		f(4);`, 10},
+		// Tail calls at the top level of a program
+		{`let id = fn(x) { x }; return id(7);`, 7},
+		// Tail calls to builtins
+		{`let f = fn(s) { return len(s); }; f("four");`, 4},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t,
+		testEval(`let f = fn(n) { if (n == 0) { return 0; } return f(n - 1, 1); }; f(3);`),
+		"wrong number of arguments. got=2, want=1")
+	testErrorObject(t,
+		testEval(`let f = fn() { return g(1); }; f();`),
+		"identifier not found: g")
+}
+
+func TestEvaluationStepLimit(t *testing.T) {
+	original := MaxSteps
+	defer func() { MaxSteps = original }()
+	MaxSteps = 10000
+
+	tests := []string{
+		// An infinite loop: the self tail call never grows the stack
+		`let loop = fn() { return loop(); }; loop();`,
+		// Runaway non-tail recursion stops before it can overflow the stack
+		`let f = fn(x) { f(x) + 1 }; f(1);`,
+	}
+
+	for _, input := range tests {
+		testErrorObject(t, testEval(input), "evaluation limit exceeded")
+	}
+
+	// Programs within the limit are unaffected, and each program gets a fresh budget
+	for i := 0; i < 3; i++ {
+		testIntegerObject(t, testEval(`let f = fn(n) { if (n == 0) { return 0; } return f(n - 1); }; f(100);`), 0)
+	}
+
+	// Each call to Eval gets a fresh budget, including statements evaluated one at a time as the REPL debugger does
+	MaxSteps = 20
+	env := object.NewEnvironment()
+	stmt := parser.New(lexer.New(`1 + 2 * 3;`)).ParseProgram().Statements[0]
+	for i := 0; i < 50; i++ {
+		testIntegerObject(t, Eval(stmt, env), 7)
+	}
+
+	// 0 disables the limit
+	MaxSteps = 0
+	testIntegerObject(t, testEval(`let f = fn(n) { if (n == 0) { return 0; } return f(n - 1); }; f(10000);`), 0)
+}
+
+func TestEvalWithContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	program := parser.New(lexer.New(`let loop = fn() { return loop(); }; loop();`)).ParseProgram()
+	evaluated := EvalWithContext(ctx, program, object.NewEnvironment())
+	testErrorObject(t, evaluated, "evaluation cancelled")
+
+	// Eval isn't affected by the context of an earlier evaluation
+	testIntegerObject(t, testEval(`let f = fn(x) { x * 2 }; f(21);`), 42)
+
+	// Builtins that loop stop once the context is done, even when the function they call is a builtin
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	tests := []string{
+		`iterate(upper, "a", 1000000000000)`,
+		`repeat([1], 10000000)`,
+		`bench(fn() { 1 }, 1000000000)`,
+		`all(["a", "b"], upper)`,
+		`find(["a", "b"], upper)`,
+		`minOf(["a", "b"], upper)`,
+	}
+	for _, input := range tests {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		testErrorObject(t, EvalWithContext(cancelled, program, object.NewEnvironment()), "evaluation cancelled")
+	}
+}
+
+func TestConcurrentEvaluations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	looping := make(chan object.Object)
+	go func() {
+		program := parser.New(lexer.New(`let loop = fn() { return loop(); }; loop();`)).ParseProgram()
+		looping <- EvalWithContext(ctx, program, object.NewEnvironment())
+	}()
+
+	// Evaluations started while the loop runs finish normally, and don't take over its context
+	results := make(chan object.Object)
+	for i := 0; i < 4; i++ {
+		go func() {
+			program := parser.New(lexer.New(`let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(500);`)).ParseProgram()
+			results <- Eval(program, object.NewEnvironment())
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		testIntegerObject(t, <-results, 125250)
+	}
+
+	cancel()
+	select {
+	case evaluated := <-looping:
+		testErrorObject(t, evaluated, "evaluation cancelled")
+	case <-time.After(5 * time.Second):
+		t.Fatalf("cancelling one evaluation didn't stop it while others ran")
+	}
+}
+
+// In-memory filesystem for testing the file builtins
+type stubFileSystem struct {
+	files    map[string]string
+	readOnly bool
+}
+
+func (fs *stubFileSystem) ReadFile(name string) ([]byte, error) {
+	contents, ok := fs.files[name]
+	if !ok {
+		return nil, fmt.Errorf("open %s: file does not exist", name)
+	}
+	return []byte(contents), nil
+}
+
+func (fs *stubFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if fs.readOnly {
+		return fmt.Errorf("open %s: read-only file system", name)
+	}
+	fs.files[name] = string(data)
+	return nil
+}
+
+func TestReadFileBuiltin(t *testing.T) {
+	original := Files
+	defer func() { Files = original }()
+	Files = &stubFileSystem{files: map[string]string{"notes.txt": "hello\nworld"}}
+
+	testStringObject(t, testEval(`readFile("notes.txt")`), "hello\nworld")
+	testIntegerObject(t, testEval(`len(readFile("notes.txt"))`), 11)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`readFile("missing.txt")`, "could not read file: open missing.txt: file does not exist"},
+		{`readFile(1)`, "argument to `readFile` must be STRING, got INTEGER"},
+		{`readFile()`, "wrong number of arguments. got=0, want=1"},
+		{`readFile("a", "b")`, "wrong number of arguments. got=2, want=1"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestWriteFileBuiltin(t *testing.T) {
+	original := Files
+	defer func() { Files = original }()
+	fs := &stubFileSystem{files: map[string]string{"notes.txt": "old"}}
+	Files = fs
+
+	testNullObject(t, testEval(`writeFile("notes.txt", "hello")`))
+	testNullObject(t, testEval(`writeFile("new.txt", "a" + "b")`))
+	if fs.files["notes.txt"] != "hello" {
+		t.Errorf("notes.txt has wrong contents. got=%q, want=%q", fs.files["notes.txt"], "hello")
+	}
+	if fs.files["new.txt"] != "ab" {
+		t.Errorf("new.txt has wrong contents. got=%q, want=%q", fs.files["new.txt"], "ab")
+	}
+
+	// Written files can be read back
+	testStringObject(t, testEval(`writeFile("copy.txt", readFile("notes.txt")); readFile("copy.txt")`), "hello")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`writeFile(1, "x")`, "first argument to `writeFile` must be STRING, got INTEGER"},
+		{`writeFile("a.txt", 1)`, "second argument to `writeFile` must be STRING, got INTEGER"},
+		{`writeFile("a.txt")`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+
+	fs.readOnly = true
+	testErrorObject(t, testEval(`writeFile("notes.txt", "x")`), "could not write file: open notes.txt: read-only file system")
+}
+
+func TestEnvironmentVariableBuiltins(t *testing.T) {
+	originalLookup, originalSet := LookupEnv, Setenv
+	defer func() { LookupEnv, Setenv = originalLookup, originalSet }()
+
+	vars := map[string]string{"HOME": "/home/clear", "EMPTY": ""}
+	LookupEnv = func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+	Setenv = func(key, value string) error {
+		if key == "" {
+			return fmt.Errorf("setenv: invalid argument")
+		}
+		vars[key] = value
+		return nil
+	}
+
+	testStringObject(t, testEval(`getenv("HOME")`), "/home/clear")
+	testStringObject(t, testEval(`getenv("EMPTY")`), "")
+	testNullObject(t, testEval(`getenv("MISSING")`))
+
+	testNullObject(t, testEval(`setenv("MODE", "debug")`))
+	if vars["MODE"] != "debug" {
+		t.Errorf("MODE has wrong value. got=%q, want=%q", vars["MODE"], "debug")
+	}
+	testStringObject(t, testEval(`setenv("MODE", "release"); getenv("MODE")`), "release")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`getenv(1)`, "argument to `getenv` must be STRING, got INTEGER"},
+		{`getenv()`, "wrong number of arguments. got=0, want=1"},
+		{`setenv(1, "x")`, "first argument to `setenv` must be STRING, got INTEGER"},
+		{`setenv("KEY", true)`, "second argument to `setenv` must be STRING, got BOOLEAN"},
+		{`setenv("KEY")`, "wrong number of arguments. got=1, want=2"},
+		{`setenv("", "x")`, "could not set environment variable: setenv: invalid argument"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMatchTypeBuiltin(t *testing.T) {
+	handlers := `
+	let describe = fn(x) {
+		match_type(x, fn(i) { i * 2 }, fn(s) { s + "!" }, fn(other) { "other" })
+	};
+	`
+	testIntegerObject(t, testEval(handlers+`describe(21)`), 42)
+	testStringObject(t, testEval(handlers+`describe("hi")`), "hi!")
+	testStringObject(t, testEval(handlers+`describe(true)`), "other")
+	testStringObject(t, testEval(handlers+`describe([1, 2])`), "other")
+
+	// Builtins can be used as handlers
+	testIntegerObject(t, testEval(`match_type("hello", fn(i) { i }, len, fn(x) { 0 })`), 5)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match_type(1, fn(i) { i }, 5, fn(x) { x })`, "handlers passed to `match_type` must be FUNCTION, got INTEGER"},
+		{`match_type(1, fn(i) { i }, fn(s) { s })`, "wrong number of arguments. got=3, want=4"},
+		{`match_type(1, fn() { 1 }, fn(s) { s }, fn(x) { x })`, "wrong number of arguments. got=1, want=0"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBlockExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{ 5 }`, 5},
+		{`let x = { let y = 5; y * 2 }; x`, 10},
+		{`let x = { 1; 2; 3 }; x`, 3},
+		{`let x = 1; let y = { let x = 2; x }; x + y`, 3},
+		{`let f = fn(n) { let doubled = { n * 2 }; doubled + 1 }; f(4)`, 9},
+		{`if (true) { { 7 } }`, 7},
+		{`let x = { let y = 5; }; x`, nil},
+		{`let f = fn() { { return 1; }; 2 }; f()`, 1},
+		{`{ let inner = 1; }; inner`, "identifier not found: inner"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestPipeOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let double = fn(x) { x * 2 }; let inc = fn(x) { x + 1 }; 5 |> double |> inc`, 11},
+		{`let double = fn(x) { x * 2 }; let inc = fn(x) { x + 1 }; 5 |> inc |> double`, 12},
+		{`let add = fn(a, b) { a + b }; 1 |> add(2) |> add(3)`, 6},
+		{`"hello" |> upper |> len`, 5},
+		{`"  hi  " |> trim |> upper`, "HI"},
+		{`[1, 2, 3] |> len`, 3},
+		{`5 |> fn(x) { x * x }`, 25},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	testErrorObject(t, testEval(`5 |> 6`), "not a function: INTEGER")
+}
+
+func TestImmediatelyInvokedFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`fn(x) { x * 2 }(21)`, 42},
+		{`fn() { 7 }()`, 7},
+		{`let y = 2; fn(x) { x * y }(21)`, 42},
+		{`let result = fn(a, b) { a + b }(1, 2); result`, 3},
+		{`fn(x) { fn(y) { x + y } }(1)(2)`, 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPrettyBuiltin(t *testing.T) {
+	input := `pretty([{"name": "clear", "tags": ["lang", "go"], "stars": 10}, {}, [], 1.5, null])`
+	input = `let null = if (false) { 1 }; ` + input
+	expected := `[
+  {
+    "name": "clear",
+    "stars": 10,
+    "tags": [
+      "lang",
+      "go"
+    ]
+  },
+  {},
+  [],
+  1.5,
+  null
+]`
+	testStringObject(t, testEval(input), expected)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`pretty(5)`, "5"},
+		{`pretty("hi")`, `"hi"`},
+		{`pretty({2: true, 1: false, 10: true})`, "{\n  1: false,\n  2: true,\n  10: true\n}"},
+		{`pretty([[1]])`, "[\n  [\n    1\n  ]\n]"},
+	}
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(`pretty()`), "wrong number of arguments. got=0, want=1")
+}
+
+func TestJSONEncodeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`jsonEncode(5)`, `5`},
+		{`jsonEncode(-1.5)`, `-1.5`},
+		{`jsonEncode(true)`, `true`},
+		{`jsonEncode("tab	and <b>")`, `"tab\tand <b>"`},
+		{`jsonEncode(if (false) { 1 })`, `null`},
+		{`jsonEncode([1, "two", [3]])`, `[1,"two",[3]]`},
+		{`jsonEncode([])`, `[]`},
+		{`jsonEncode({})`, `{}`},
+		{`jsonEncode({"b": true, "a": [1, 2]})`, `{"a":[1,2],"b":true}`},
+		{`jsonEncode({"outer": {"inner": {"x": 1}}})`, `{"outer":{"inner":{"x":1}}}`},
+		{`jsonEncode({1: "one", true: "yes"})`, `{"1":"one","true":"yes"}`},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testStringObject(t, evaluated, tt.expected) {
+			continue
+		}
+		if !json.Valid([]byte(evaluated.(*object.String).Value)) {
+			t.Errorf("jsonEncode output is not valid JSON. got=%q", evaluated.Inspect())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`jsonEncode(fn(x) { x })`, "could not encode JSON: FUNCTION has no JSON representation"},
+		{`jsonEncode({"f": [len]})`, "could not encode JSON: BUILTIN has no JSON representation"},
+		{`jsonEncode()`, "wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// Keys that print the same can't both become JSON keys. Which one is reported first depends on hash order
+	collisions := []struct {
+		input    string
+		expected []string
+	}{
+		{`jsonEncode({1: "int", "1": "str"})`, []string{
+			`could not encode JSON: keys INTEGER and STRING both encode as "1"`,
+			`could not encode JSON: keys STRING and INTEGER both encode as "1"`,
+		}},
+		{`jsonEncode({"a": {true: 1, "true": 2}})`, []string{
+			`could not encode JSON: keys BOOLEAN and STRING both encode as "true"`,
+			`could not encode JSON: keys STRING and BOOLEAN both encode as "true"`,
+		}},
+	}
+	for _, tt := range collisions {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %s. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected[0] && errObj.Message != tt.expected[1] {
+			t.Errorf("wrong error message for %s. expected=%q, got=%q", tt.input, tt.expected[0], errObj.Message)
+		}
+	}
+}
+
+func TestJSONDecodeBuiltin(t *testing.T) {
+	decoded := builtins["jsonDecode"].Fn(&object.String{Value: `{"a": 1, "b": [2.5, true, null], "c": {"d": "e"}}`})
+	hash, ok := decoded.(*object.Hash)
+	if !ok {
+		t.Fatalf("jsonDecode didn't return Hash. got=%T (%+v)", decoded, decoded)
+	}
+	value := func(obj object.Object, key string) object.Object {
+		return obj.(*object.Hash).Pairs[(&object.String{Value: key}).HashKey()].Value
+	}
+	testIntegerObject(t, value(hash, "a"), 1)
+	b, ok := value(hash, "b").(*object.Array)
+	if !ok || len(b.Elements) != 3 {
+		t.Fatalf("b is not a 3 element Array. got=%T (%+v)", value(hash, "b"), value(hash, "b"))
+	}
+	testFloatObject(t, b.Elements[0], 2.5)
+	testBooleanObject(t, b.Elements[1], true)
+	testNullObject(t, b.Elements[2])
+	testStringObject(t, value(value(hash, "c"), "d"), "e")
+
+	// Values survive a round trip through jsonEncode
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`jsonEncode(jsonDecode(jsonEncode({"a": [1, 2], "b": {"c": true}})))`, `{"a":[1,2],"b":{"c":true}}`},
+		{`jsonEncode(jsonDecode(jsonEncode([1, 1.5, "x", false])))`, `[1,1.5,"x",false]`},
+		{`jsonDecode(jsonEncode({"greeting": "hi"}))["greeting"]`, `hi`},
+		{`jsonDecode("  " + jsonEncode("x") + "  ")`, `x`},
+	}
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+	testIntegerObject(t, testEval(`jsonDecode("[1, 2, 3]")[2]`), 3)
+	testIntegerObject(t, testEval(`jsonDecode("9007199254740993")`), 9007199254740993)
+	testFloatObject(t, testEval(`jsonDecode("1e3")`), 1000)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`jsonDecode("{")`, "could not decode JSON: invalid JSON"},
+		{`jsonDecode("[1] 2")`, "could not decode JSON: invalid JSON"},
+		{`jsonDecode(1)`, "argument to `jsonDecode` must be STRING, got INTEGER"},
+		{`jsonDecode()`, "wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPlusPrefixOperator(t *testing.T) {
+	testIntegerObject(t, testEval(`+5`), 5)
+	testIntegerObject(t, testEval(`+-5`), -5)
+	testIntegerObject(t, testEval(`-+5`), -5)
+	testIntegerObject(t, testEval(`3 - +2`), 1)
+	testFloatObject(t, testEval(`+1.5`), 1.5)
+
+	testErrorObject(t, testEval(`+true`), "unknown operator: +BOOLEAN")
+	testErrorObject(t, testEval(`+"a"`), "unknown operator: +STRING")
+}
+
+func TestChainedCallsAndIndexes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let getArray = fn() { [1, 2, 3] }; getArray()[1]`, 2},
+		{`let matrix = [[1, 2], [3, 4]]; matrix[1][0]`, 3},
+		{`let h = {"a": {"b": 5}}; h["a"]["b"]`, 5},
+		{`let fns = [fn(x) { x * 2 }]; fns[0](21)`, 42},
+		{`let grid = fn() { [[0, fn() { [7] }]] }; grid()[0][1]()[0]`, 7},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEnumerateBuiltin(t *testing.T) {
+	evaluated := testEval(`enumerate(["a", "b", "c"])`)
+	arr, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(arr.Elements) != 3 {
+		t.Fatalf("wrong number of elements. got=%d", len(arr.Elements))
+	}
+	for i, expected := range []string{"a", "b", "c"} {
+		pair, ok := arr.Elements[i].(*object.Array)
+		if !ok || len(pair.Elements) != 2 {
+			t.Fatalf("element %d is not a pair. got=%T (%+v)", i, arr.Elements[i], arr.Elements[i])
+		}
+		testIntegerObject(t, pair.Elements[0], int64(i))
+		testStringObject(t, pair.Elements[1], expected)
+	}
+
+	testIntegerObject(t, testEval(`len(enumerate([]))`), 0)
+	testIntegerObject(t, testEval(`enumerate([5, 6])[1][0]`), 1)
+	testErrorObject(t, testEval(`enumerate("ab")`), "argument to `enumerate` must be ARRAY, got STRING")
+	testErrorObject(t, testEval(`enumerate([], [])`), "wrong number of arguments. got=2, want=1")
+}
+
+func TestZipBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`zip([1, 2, 3], ["a", "b", "c"])`, `[[1, a], [2, b], [3, c]]`},
+		{`zip([1, 2, 3], ["a"])`, `[[1, a]]`},
+		{`zip([1], [true, false])`, `[[1, true]]`},
+		{`zip([], [1, 2])`, `[]`},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		arr, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if arr.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, arr.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`zip(1, [])`), "first argument to `zip` must be ARRAY, got INTEGER")
+	testErrorObject(t, testEval(`zip([], "a")`), "second argument to `zip` must be ARRAY, got STRING")
+	testErrorObject(t, testEval(`zip([])`), "wrong number of arguments. got=1, want=2")
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Clear"; "Hello, ${name}!"`, "Hello, Clear!"},
+		{`let a = 2; "${a} * 3 = ${a * 3}"`, "2 * 3 = 6"},
+		{`"${[1, 2]} ${true} ${1.5}"`, "[1, 2] true 1.5"},
+		{`"${upper("clear")}${"!"}"`, "CLEAR!"},
+		{`let h = {"k": "v"}; "${h["k"]}"`, "v"},
+		{`"costs \${price}"`, "costs ${price}"},
+		{`let price = 5; "\${price} is ${price}"`, "${price} is 5"},
+	}
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(`"${missing}"`), "identifier not found: missing")
+}
+
+func TestSumAndProductBuiltins(t *testing.T) {
+	testIntegerObject(t, testEval(`sum([1, 2, 3])`), 6)
+	testIntegerObject(t, testEval(`product([1, 2, 3, 4])`), 24)
+	testIntegerObject(t, testEval(`sum([-5])`), -5)
+	testFloatObject(t, testEval(`sum([1.5, 2.25])`), 3.75)
+	testFloatObject(t, testEval(`product([1.5, 2.0])`), 3)
+
+	// The identities for empty arrays
+	testIntegerObject(t, testEval(`sum([])`), 0)
+	testIntegerObject(t, testEval(`product([])`), 1)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sum([1, 2.5])`, "elements passed to `sum` must all be INTEGER, got FLOAT"},
+		{`product([1.5, 2])`, "elements passed to `product` must all be FLOAT, got INTEGER"},
+		{`sum(["a", "b"])`, "elements passed to `sum` must be INTEGER or FLOAT, got STRING"},
+		{`sum([1, true])`, "elements passed to `sum` must all be INTEGER, got BOOLEAN"},
+		{`product(5)`, "argument to `product` must be ARRAY, got INTEGER"},
+		{`sum([1], [2])`, "wrong number of arguments. got=2, want=1"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestUniqueBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`unique([1, 2, 2, 3, 1])`, `[1, 2, 3]`},
+		{`unique(["b", "a", "b", "c", "a"])`, `[b, a, c]`},
+		{`unique([1, 2, 3])`, `[1, 2, 3]`},
+		{`unique([true, false, true])`, `[true, false]`},
+		{`unique([1, "1", true])`, `[1, 1, true]`},
+		{`unique([])`, `[]`},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		arr, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if arr.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, tt.expected, arr.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`unique([1, [2]])`), "elements passed to `unique` must be hashable, got ARRAY")
+	testErrorObject(t, testEval(`unique(1.5)`), "argument to `unique` must be ARRAY, got FLOAT")
+	testErrorObject(t, testEval(`unique()`), "wrong number of arguments. got=0, want=1")
+}
+
+func TestIterateBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let double = fn(x) { x * 2 }; iterate(double, 1, 5)`, 32},
+		{`iterate(fn(x) { x * 2 }, 3, 0)`, 3},
+		{`iterate(fn(s) { s + "a" }, "", 3)`, "aaa"},
+		{`iterate(upper, "abc", 2)`, "ABC"},
+		{`iterate(fn(x) { x + 1 }, 0, 1000)`, 1000},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`iterate(fn(x) { x + true }, 1, 3)`, "type mismatch: INTEGER + BOOLEAN"},
+		{`iterate(5, 1, 3)`, "first argument to `iterate` must be FUNCTION, got INTEGER"},
+		{`iterate(fn(x) { x }, 1, "3")`, "third argument to `iterate` must be INTEGER, got STRING"},
+		{`iterate(fn(x) { x }, 1, -1)`, "third argument to `iterate` must be non-negative, got -1"},
+		{`iterate(fn(x) { x }, 1)`, "wrong number of arguments. got=2, want=3"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestComposeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; compose(inc, double)(5)`, 11},
+		{`let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; compose(double, inc)(5)`, 12},
+		{`let shout = compose(fn(s) { s + "!" }, upper); shout("hi")`, "HI!"},
+		{`let add = fn(a, b) { a + b }; compose(fn(x) { x * 10 }, add)(1, 2)`, 30},
+		{`let inc = fn(x) { x + 1 }; compose(compose(inc, inc), inc)(0)`, 3},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`compose(fn(x) { x }, 5)`, "arguments to `compose` must be FUNCTION, got INTEGER"},
+		{`compose(fn(x) { x })`, "wrong number of arguments. got=1, want=2"},
+		{`compose(fn(x) { x }, fn(x) { x + true })(1)`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPartialBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let add = fn(a, b) { a + b }; let inc = partial(add, 1); inc(41)`, 42},
+		{`let add = fn(a, b) { a + b }; partial(add, 1, 2)()`, 3},
+		{`let add = fn(a, b) { a + b }; partial(add)(1, 2)`, 3},
+		{`let subtract = fn(a, b, c) { a - b - c }; partial(partial(subtract, 10), 3)(2)`, 5},
+		{`let greet = partial(fn(greeting, name) { greeting + ", " + name }, "Hello"); greet("Clear")`, "Hello, Clear"},
+		{`partial(repeat, [0])(3)`, "[0, 0, 0]"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`partial(1, 2)`, "first argument to `partial` must be FUNCTION, got INTEGER"},
+		{`partial()`, "wrong number of arguments. got=0, want at least 1"},
+		{`partial(fn(a, b) { a + b }, 1)(2, 3)`, "wrong number of arguments. got=3, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMemoizeBuiltin(t *testing.T) {
+	calls := 0
+	env := object.NewEnvironment()
+	env.Set("expensive", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		calls++
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}})
+	run := func(input string) object.Object {
+		return Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	run(`let cached = memoize(expensive);`)
+	testIntegerObject(t, run(`cached(21)`), 42)
+	testIntegerObject(t, run(`cached(21)`), 42)
+	testIntegerObject(t, run(`cached(21) + cached(21)`), 84)
+	if calls != 1 {
+		t.Errorf("memoized function called wrong number of times. got=%d, want=1", calls)
+	}
+	testIntegerObject(t, run(`cached(5)`), 10)
+	if calls != 2 {
+		t.Errorf("memoized function called wrong number of times. got=%d, want=2", calls)
+	}
+
+	// Memoizing a recursive Clear function through its own binding
+	testIntegerObject(t, testEval(`
+	let fib = memoize(fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) });
+	fib(80)
+	`), 23416728348467685)
+
+	// Arguments are told apart by type as well as value
+	testStringObject(t, testEval(`let f = memoize(fn(x) { match_type(x, fn(i) { "int" }, fn(s) { "str" }, fn(o) { "other" }) }); f(1); f("1")`), "str")
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`memoize(fn(x) { x })([1])`, "arguments to a memoized function must be hashable, got ARRAY"},
+		{`memoize(1)`, "argument to `memoize` must be FUNCTION, got INTEGER"},
+		{`memoize()`, "wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestZeroIsFalsy(t *testing.T) {
+	original := ZeroIsFalsy
+	defer func() { ZeroIsFalsy = original }()
+
+	tests := []struct {
+		input       string
+		defaultTo   int64
+		zeroIsFalsy int64
+	}{
+		{`if (0) { 1 } else { 2 }`, 1, 2},
+		{`if (5) { 1 } else { 2 }`, 1, 1},
+		{`if (-1) { 1 } else { 2 }`, 1, 1},
+		{`if (0.0) { 1 } else { 2 }`, 1, 2},
+		{`if ("") { 1 } else { 2 }`, 1, 2},
+		{`if ("a") { 1 } else { 2 }`, 1, 1},
+		{`if ([]) { 1 } else { 2 }`, 1, 2},
+		{`if ([0]) { 1 } else { 2 }`, 1, 1},
+		{`if (false) { 1 } else { 2 }`, 2, 2},
+	}
+	for _, tt := range tests {
+		ZeroIsFalsy = false
+		testIntegerObject(t, testEval(tt.input), tt.defaultTo)
+		ZeroIsFalsy = true
+		testIntegerObject(t, testEval(tt.input), tt.zeroIsFalsy)
+	}
+
+	ZeroIsFalsy = false
+	testBooleanObject(t, testEval(`!0`), false)
+	testBooleanObject(t, testEval(`bool("")`), true)
+	ZeroIsFalsy = true
+	testBooleanObject(t, testEval(`!0`), true)
+	testBooleanObject(t, testEval(`!!7`), true)
+	testBooleanObject(t, testEval(`bool("")`), false)
+}
+
+func TestFloorDivision(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"7 // 2", 3},
+		{"6 // 2", 3},
+		{"-7 // 2", -4},
+		{"7 // -2", -4},
+		{"-7 // -2", 3},
+		{"-6 // 2", -3},
+		{"0 // 5", 0},
+		{"1 + 7 // 2 * 2", 7},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testFloatObject(t, testEval("7.5 // 2"), 3)
+	testFloatObject(t, testEval("-7.5 // 2"), -4)
+	testIntegerObject(t, testEval("-7 / 2"), -3) // Plain division still truncates
+	testErrorObject(t, testEval("1 // 0"), "division by zero: 1 // 0")
+	testErrorObject(t, testEval("1.5 // 0"), "division by zero: 1.5 // 0")
+	testErrorObject(t, testEval("-2 // 0.0"), "division by zero: -2 // 0.0")
+}
+
+func TestClampBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`clamp(-5, 0, 10)`, 0},
+		{`clamp(5, 0, 10)`, 5},
+		{`clamp(15, 0, 10)`, 10},
+		{`clamp(3, 3, 3)`, 3},
+		{`clamp(1.5, 0, 1)`, 1.0},
+		{`clamp(5, 0, 2.5)`, 2.5},
+		{`clamp(1, 0, 10.0)`, 1.0},
+		{`clamp(-0.5, -1.5, 0.5)`, -0.5},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`clamp(5, 10, 0)`, "lower bound passed to `clamp` must not exceed the upper bound, got 10 > 0"},
+		{`clamp("5", 0, 10)`, "arguments to `clamp` must be INTEGER or FLOAT, got STRING"},
+		{`clamp(5, 0)`, "wrong number of arguments. got=2, want=3"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestUnusableHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{fn(x) { x }: 1}`, "unusable as hash key: FUNCTION"},
+		{`{[1, 2]: 1}`, "unusable as hash key: ARRAY"},
+		{`{len: 1}`, "unusable as hash key: BUILTIN"},
+		{`{{}: 1}`, "unusable as hash key: HASH"},
+		{`{1.5: 1}`, "unusable as hash key: FLOAT"},
+		{`{"a": 1}[fn(x) { x }]`, "unusable as hash key: FUNCTION"},
+		{`{"a": 1}[[1]]`, "unusable as hash key: ARRAY"},
+		{`let f = fn() { 1 }; let h = {"f": f}; h[f]`, "unusable as hash key: FUNCTION"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// Functions can still be stored as values
+	testIntegerObject(t, testEval(`let h = {"double": fn(x) { x * 2 }}; h["double"](4)`), 8)
+}
+
+func TestHashBuiltin(t *testing.T) {
+	testBooleanObject(t, testEval(`hash("hello") == hash("hel" + "lo")`), true)
+	testBooleanObject(t, testEval(`hash("hello") == hash("world")`), false)
+	testBooleanObject(t, testEval(`hash("a") == hash("b")`), false)
+	testIntegerObject(t, testEval(`hash(42)`), 42)
+	testIntegerObject(t, testEval(`hash(-1)`), -1)
+	testIntegerObject(t, testEval(`hash(true)`), 1)
+	testIntegerObject(t, testEval(`hash(false)`), 0)
+
+	str := &object.String{Value: "clear"}
+	testIntegerObject(t, testEval(`hash("clear")`), int64(str.HashKey().Value))
+
+	testErrorObject(t, testEval(`hash([1])`), "argument to `hash` must be hashable, got ARRAY")
+	testErrorObject(t, testEval(`hash(fn() { 1 })`), "argument to `hash` must be hashable, got FUNCTION")
+	testErrorObject(t, testEval(`hash()`), "wrong number of arguments. got=0, want=1")
+}
+
+func TestArrowFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let double = (x) => x * 2; double(21)`, 42},
+		{`let add = (a, b) => a + b; add(1, 2)`, 3},
+		{`let seven = () => 7; seven()`, 7},
+		{`let adder = (x) => (y) => x + y; adder(1)(2)`, 3},
+		{`((x) => x * x)(5)`, 25},
+		{`iterate((x) => x + 2, 0, 5)`, 10},
+		{`let countdown = (n) => if (n == 0) { 0 } else { countdown(n - 1) }; countdown(100)`, 0},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLenOfHash(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`len({})`, 0},
+		{`len({"a": 1})`, 1},
+		{`len({"a": 1, "b": 2, 3: true})`, 3},
+		{`len({"a": 1, "a": 2})`, 1},
+		{`len({"a": 1} + {"b": 2})`, 2},
+		{`let h = {"x": 1, "y": 2}; h.len()`, 2},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(`len(true)`), "argument to `len` not supported, got BOOLEAN")
+}
+
+func TestTrace(t *testing.T) {
+	var out bytes.Buffer
+	originalOut, originalTrace := Out, Trace
+	Out, Trace = &out, true
+	defer func() { Out, Trace = originalOut, originalTrace }()
+
+	testIntegerObject(t, testEval("1 + 2"), 3)
+
+	expected := "Program\n  ExpressionStatement\n    InfixExpression\n      IntegerLiteral\n      IntegerLiteral\n"
+	if out.String() != expected {
+		t.Errorf("wrong trace output. expected=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	Trace = false
+	testEval("1 + 2")
+	if out.Len() != 0 {
+		t.Errorf("trace output written while disabled: %q", out.String())
+	}
+}
+
+// Starts a second traced evaluation the first time a statement is traced, as another goroutine might
+type nestedTraceWriter struct {
+	out     bytes.Buffer
+	started bool
+}
+
+func (w *nestedTraceWriter) Write(p []byte) (int, error) {
+	n, err := w.out.Write(p)
+	if !w.started && strings.Contains(string(p), "Statement") {
+		w.started = true
+		testEval("true")
+	}
+	return n, err
+}
+
+func TestTraceDepthPerEvaluation(t *testing.T) {
+	w := &nestedTraceWriter{}
+	originalOut, originalTrace := Out, Trace
+	Out, Trace = w, true
+	defer func() { Out, Trace = originalOut, originalTrace }()
+
+	testIntegerObject(t, testEval("1"), 1)
+
+	// The second evaluation is indented from its own program, not from where the first one had got to
+	expected := "Program\n  ExpressionStatement\n" +
+		"Program\n  ExpressionStatement\n    Boolean\n" +
+		"    IntegerLiteral\n"
+	if w.out.String() != expected {
+		t.Errorf("wrong trace output. expected=%q, got=%q", expected, w.out.String())
+	}
+}
+
+func TestTypeAssertionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`asInt(5)`, 5},
+		{`asString("hi")`, "hi"},
+		{`asBool(true)`, true},
+		{`len(asArray([1, 2, 3]))`, 3},
+		{`asHash({"a": 1})["a"]`, 1},
+		{`let double = fn(x) { asInt(x) * 2 }; double(4)`, 8},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`asInt("5")`, "expected INTEGER, got STRING"},
+		{`asString(5)`, "expected STRING, got INTEGER"},
+		{`asBool(1)`, "expected BOOLEAN, got INTEGER"},
+		{`asArray({})`, "expected ARRAY, got HASH"},
+		{`asHash([])`, "expected HASH, got ARRAY"},
+		{`asInt(1.5)`, "expected INTEGER, got FLOAT"},
+		{`asInt()`, "wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayOrdering(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 3] < [1, 2]", false},
+		{"[1, 2] > [1, 1, 9]", true},
+		{"[1, 2] < [1, 2, 0]", true},
+		{"[1, 2, 0] > [1, 2]", true},
+		{"[] < [1]", true},
+		{"[] < []", false},
+		{"[1, 2] <= [1, 2]", true},
+		{"[1, 2] >= [1, 2]", true},
+		{"[1, 2] <= [1]", false},
+		{"[2] >= [1, 5]", true},
+		{"[1, 2.5] < [1, 3]", true},
+		{`["a", "b"] < ["a", "c"]`, true},
+		{"[[1, 2], 3] < [[1, 3], 0]", true},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2] < ["a", 2]`, "cannot order array elements: INTEGER and STRING"},
+		{"[true] < [false]", "cannot order array elements: BOOLEAN and BOOLEAN"},
+		{"[1] - [1]", "type mismatch: ARRAY - ARRAY"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestToHash(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`toHash(["a", "b"], [1, 2])["a"]`, 1},
+		{`toHash(["a", "b"], [1, 2])["b"]`, 2},
+		{`len(toHash(["a", "b"], [1, 2]))`, 2},
+		{`len(toHash([], []))`, 0},
+		{`toHash([1, true], ["one", "yes"])[true]`, "yes"},
+		{`toHash(["a", "a"], [1, 2])["a"]`, 2},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`toHash(["a", "b"], [1])`, "arrays passed to `toHash` must have the same length, got 2 and 1"},
+		{`toHash([[1]], [1])`, "unusable as hash key: ARRAY"},
+		{`toHash({}, [1])`, "first argument to `toHash` must be ARRAY, got HASH"},
+		{`toHash([1], 1)`, "second argument to `toHash` must be ARRAY, got INTEGER"},
+		{`toHash([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let add = fn(a, b, c) { a + b * c }; apply(add, [1, 2, 3])`, 7},
+		{`apply(fn() { 5 }, [])`, 5},
+		{`apply(len, [[1, 2]])`, 2},
+		{`apply(sum, [[3, 9, 4]])`, 16},
+		{`let args = enumerate([10])[0]; apply(fn(i, x) { i + x }, args)`, 10},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`apply(fn(a, b) { a + b }, [1])`, "wrong number of arguments. got=1, want=2"},
+		{`apply(1, [1])`, "first argument to `apply` must be FUNCTION, got INTEGER"},
+		{`apply(len, 1)`, "second argument to `apply` must be ARRAY, got INTEGER"},
+		{`apply(len)`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDestructuringAndUnderscore(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let [_, b] = [1, 2]; b;", 2},
+		{"let [a, b] = [1, 2]; a + b;", 3},
+		{"let [_, _, c] = [1, 2, 3]; c;", 3},
+		{"let [a] = [7, 8, 9]; a;", 7},
+		{"let pair = fn() { [4, 5] }; let [x, y] = pair(); x * y;", 20},
+		{"let ignore = fn(_, _, c) { c }; ignore(1, 2, 3);", 3},
+		{"let f = fn(_) { 1 }; f(100);", 1},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testNullObject(t, testEval("let [a, b] = [1]; b;"))
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"let [_, b] = [1, 2]; _;", "identifier not found: _"},
+		{"let _ = 5; _;", "identifier not found: _"},
+		{"let [a, b] = 5;", "cannot destructure INTEGER, expected ARRAY"},
+		{"let [a] = fn() {}();", "cannot destructure NULL, expected ARRAY"},
+		{"let [a] = fn() { let b = 1; }();", "cannot destructure NULL, expected ARRAY"},
+		{"let [a] = [missing];", "identifier not found: missing"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIsNull(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`isNull(if (false) { 1 })`, true},
+		{`isNull({"a": 1}["b"])`, true},
+		{`let [a, b] = [1]; isNull(b)`, true},
+		{`isNull(0)`, false},
+		{`isNull("")`, false},
+		{`isNull(false)`, false},
+		{`isNull([])`, false},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(`isNull()`), "wrong number of arguments. got=0, want=1")
+	testErrorObject(t, testEval(`isNull(1, 2)`), "wrong number of arguments. got=2, want=1")
+}
+
+func TestReturnValuesAreUnwrapped(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 5;", 5},
+		{"return 5; 10;", 5},
+		{"if (true) { return 5; }", 5},
+		{"let x = { return 5; }; x + 1", 5},
+		{"let f = fn() { let x = { return 5; }; x * 2 }; f()", 5},
+		{"let f = fn() { return 3; }; f() + 1", 4},
+		{"let x = fn() { let a = 1; }(); 5", 5},
+		{"let [a, b] = { return 5; }; a + b", 5},
+		{"let f = fn() { let [a, b] = { return 7; }; a }; f()", 7},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if _, ok := evaluated.(*object.ReturnValue); ok {
+			t.Errorf("%s leaked a ReturnValue", tt.input)
+			continue
+		}
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	// A function whose body ends in a let gives no value, which is bound as it is
+	if evaluated := testEval("let x = fn() { let a = 1; }(); x"); evaluated != nil {
+		t.Errorf("expected no value. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestChars(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`chars("abc")`, []string{"a", "b", "c"}},
+		{`chars("")`, []string{}},
+		{`chars("héllo")`, []string{"h", "é", "l", "l", "o"}},
+		{`chars("日本")`, []string{"日", "本"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		arr, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Errorf("%s is not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if len(arr.Elements) != len(tt.expected) {
+			t.Errorf("%s has wrong number of elements. expected=%d, got=%d", tt.input, len(tt.expected), len(arr.Elements))
+			continue
+		}
+		for i, ch := range tt.expected {
+			testStringObject(t, arr.Elements[i], ch)
+		}
+	}
+
+	testErrorObject(t, testEval(`chars(1)`), "argument to `chars` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`chars()`), "wrong number of arguments. got=0, want=1")
+}
+
+func TestOrdAndChr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`ord("A")`, 65},
+		{`ord("a")`, 97},
+		{`ord("é")`, 233},
+		{`ord("日")`, 26085},
+		{`chr(65)`, "A"},
+		{`chr(233)`, "é"},
+		{`chr(ord("z"))`, "z"},
+		{`chr(ord("日"))`, "日"},
+		{`ord(chr(128512))`, 128512},
+		{`chr(ord("a") + 1)`, "b"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`ord("")`, "argument to `ord` must be a single character, got \"\""},
+		{`ord("ab")`, "argument to `ord` must be a single character, got \"ab\""},
+		{`ord(65)`, "argument to `ord` must be STRING, got INTEGER"},
+		{`chr(-1)`, "argument to `chr` must be a valid code point, got -1"},
+		{`chr(55296)`, "argument to `chr` must be a valid code point, got 55296"},
+		{`chr(1114112)`, "argument to `chr` must be a valid code point, got 1114112"},
+		{`chr("A")`, "argument to `chr` must be INTEGER, got STRING"},
+		{`chr()`, "wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let arr = [1, 2, 3]; arr[1] = 99; arr[1]", 99},
+		{"let arr = [1, 2, 3]; arr[1] = 99", 99},
+		{"let arr = [1, 2, 3]; arr[0] = arr[2] * 2; arr[0] + arr[1]", 8},
+		{"let arr = [1, 2, 3]; let alias = arr; alias[2] = 7; arr[2]", 7},
+		{"let a = [0]; let b = [0]; a[0] = b[0] = 5; a[0] + b[0]", 10},
+		{"let m = [[1, 2], [3, 4]]; m[1][0] = 30; m[1][0]", 30},
+		{"let set = fn(arr) { arr[0] = 42 }; let arr = [1]; set(arr); arr[0]", 42},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"]`, 2},
+		{`let h = {}; h["b"] = 3; h["b"] + len(h)`, 4},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"let arr = [1, 2, 3]; arr[3] = 0", "index out of range: 3"},
+		{"let arr = [1, 2, 3]; arr[-1] = 0", "index out of range: -1"},
+		{"let arr = []; arr[0] = 0", "index out of range: 0"},
+		{`let arr = [1]; arr["a"] = 0`, "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[[1]] = 0", "unusable as hash key: ARRAY"},
+		{`let s = "abc"; s[0] = "z"`, "index assignment not supported: STRING"},
+		{"let arr = [1]; arr[0] = missing", "identifier not found: missing"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestInsertAndRemoveAt(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int64
+	}{
+		{`insert([2, 3], 0, 1)`, []int64{1, 2, 3}},
+		{`insert([1, 3], 1, 2)`, []int64{1, 2, 3}},
+		{`insert([1, 2], 2, 3)`, []int64{1, 2, 3}},
+		{`insert([], 0, 1)`, []int64{1}},
+		{`removeAt([1, 2, 3], 0)`, []int64{2, 3}},
+		{`removeAt([1, 2, 3], 1)`, []int64{1, 3}},
+		{`removeAt([1, 2, 3], 2)`, []int64{1, 2}},
+		{`removeAt([1], 0)`, []int64{}},
+		{`let arr = [1, 2]; insert(arr, 0, 0); arr`, []int64{1, 2}},
+		{`let arr = [1, 2]; removeAt(arr, 0); arr`, []int64{1, 2}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		arr, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Errorf("%s is not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if len(arr.Elements) != len(tt.expected) {
+			t.Errorf("%s has wrong number of elements. expected=%d, got=%d", tt.input, len(tt.expected), len(arr.Elements))
+			continue
+		}
+		for i, expected := range tt.expected {
+			testIntegerObject(t, arr.Elements[i], expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`insert([1, 2], 3, 0)`, "index out of range: 3"},
+		{`insert([1, 2], -1, 0)`, "index out of range: -1"},
+		{`removeAt([1, 2], 2)`, "index out of range: 2"},
+		{`removeAt([], 0)`, "index out of range: 0"},
+		{`insert(1, 0, 0)`, "first argument to `insert` must be ARRAY, got INTEGER"},
+		{`insert([1], "0", 0)`, "second argument to `insert` must be INTEGER, got STRING"},
+		{`removeAt({}, 0)`, "first argument to `removeAt` must be ARRAY, got HASH"},
+		{`removeAt([1], true)`, "second argument to `removeAt` must be INTEGER, got BOOLEAN"},
+		{`insert([1], 0)`, "wrong number of arguments. got=2, want=3"},
+		{`removeAt([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFindAndFindIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`find([1, 2, 3, 4], fn(x) { x > 2 })`, 3},
+		{`findIndex([1, 2, 3, 4], fn(x) { x > 2 })`, 2},
+		{`find(["a", "bb", "ccc"], fn(s) { len(s) == 2 })`, "bb"},
+		{`findIndex([5], fn(x) { true })`, 0},
+		{`find([1, 2], fn(x) { x > 5 })`, nil},
+		{`find([], fn(x) { true })`, nil},
+		{`findIndex([1, 2], fn(x) { x > 5 })`, -1},
+		{`findIndex([], fn(x) { true })`, -1},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`find([1, 2], fn(x) { x + "a" })`, "type mismatch: INTEGER + STRING"},
+		{`findIndex([1, 2], fn(x) { missing })`, "identifier not found: missing"},
+		{`find(1, fn(x) { true })`, "first argument to `find` must be ARRAY, got INTEGER"},
+		{`findIndex([1], 1)`, "second argument to `findIndex` must be FUNCTION, got INTEGER"},
+		{`find([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAllAndAny(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`all([1, 5, 2], fn(x) { x > 1 })`, false},
+		{`any([1, 5, 2], fn(x) { x > 1 })`, true},
+		{`all([2, 3, 4], fn(x) { x > 1 })`, true},
+		{`any([2, 3, 4], fn(x) { x > 1 })`, true},
+		{`all([0, 1], fn(x) { x > 1 })`, false},
+		{`any([0, 1], fn(x) { x > 1 })`, false},
+		{`all([], fn(x) { false })`, true},
+		{`any([], fn(x) { true })`, false},
+		// Short-circuits before reaching the element the predicate fails on
+		{`all([1, "a"], fn(x) { x > 1 })`, false},
+		{`any([2, "a"], fn(x) { x > 1 })`, true},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`all([2, "a"], fn(x) { x > 1 })`, "type mismatch: STRING > INTEGER"},
+		{`any([0, "a"], fn(x) { x > 1 })`, "type mismatch: STRING > INTEGER"},
+		{`all(1, fn(x) { true })`, "first argument to `all` must be ARRAY, got INTEGER"},
+		{`any([1], "f")`, "second argument to `any` must be FUNCTION, got STRING"},
+		{`any([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"1 + true", 1, 3},
+		{"let a = 1;\nlet b = -true;", 2, 9},
+		{"let x = 1;\n  missing", 2, 3},
+		{"let f = fn(x) {\n  x - \"a\"\n};\nf(1)", 2, 5},
+		{"len(1, 2)", 1, 4},
+	}
+	for _, tt := range tests {
+		err, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("%q did not produce an error", tt.input)
+			continue
+		}
+		if err.Line != tt.expectedLine || err.Column != tt.expectedColumn {
+			t.Errorf("position of %q wrong. expected=%d:%d, got=%d:%d",
+				err.Message, tt.expectedLine, tt.expectedColumn, err.Line, err.Column)
+		}
+	}
+}
+
+func TestSetBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []object.Object
+	}{
+		{`set([1, 2, 2, 3])`, []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}, &object.Integer{Value: 3}}},
+		{`set([])`, []object.Object{}},
+		{`set(["a", "a"])`, []object.Object{&object.String{Value: "a"}}},
+		{`union(set([1, 2]), set([2, 3]))`, []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}, &object.Integer{Value: 3}}},
+		{`intersection(set([1, 2, 3]), set([2, 3, 4]))`, []object.Object{&object.Integer{Value: 2}, &object.Integer{Value: 3}}},
+		{`intersection(set([1]), set([2]))`, []object.Object{}},
+		{`difference(set([1, 2, 3]), set([2, 4]))`, []object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 3}}},
+		{`difference(set([1]), set([]))`, []object.Object{&object.Integer{Value: 1}}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		hash, ok := evaluated.(*object.Hash)
+		if !ok {
+			t.Errorf("%s is not Hash. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if len(hash.Pairs) != len(tt.expected) {
+			t.Errorf("%s has wrong number of pairs. expected=%d, got=%d", tt.input, len(tt.expected), len(hash.Pairs))
+			continue
+		}
+		for _, key := range tt.expected {
+			pair, ok := hash.Pairs[key.(object.Hashable).HashKey()]
+			if !ok {
+				t.Errorf("%s is missing key %s", tt.input, key.Inspect())
+				continue
+			}
+			testBooleanObject(t, pair.Value, true)
+		}
+	}
+
+	testBooleanObject(t, testEval(`set([1, 2])[2]`), true)
+	testNullObject(t, testEval(`set([1, 2])[3]`))
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`set([[1]])`, "unusable as hash key: ARRAY"},
+		{`set(1)`, "argument to `set` must be ARRAY, got INTEGER"},
+		{`union([1], set([]))`, "first argument to `union` must be HASH, got ARRAY"},
+		{`intersection(set([]), 1)`, "second argument to `intersection` must be HASH, got INTEGER"},
+		{`difference(set([]))`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIncrementExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 5; ++i", 6},
+		{"let i = 5; i++", 5},
+		{"let i = 5; ++i; i", 6},
+		{"let i = 5; i++; i", 6},
+		{"let i = 5; --i", 4},
+		{"let i = 5; i--", 5},
+		{"let i = 5; i--; i", 4},
+		{"let i = 1; i++ + ++i", 4},
+		{"let i = 1.5; ++i", 2.5},
+		{"let counter = fn() { let n = 0; fn() { ++n } }(); counter(); counter(); counter()", 3},
+		{"let n = 10; let bump = fn() { n++ }; bump(); n", 11},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"++missing", "identifier not found: missing"},
+		{"missing--", "identifier not found: missing"},
+		{`let s = "a"; ++s`, "unknown operator: ++STRING"},
+		{`let b = true; b--`, "unknown operator: BOOLEAN--"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestShadowingWarnings(t *testing.T) {
+	original := WarnShadowing
+	WarnShadowing = true
+	defer func() { WarnShadowing = original }()
+
+	testIntegerObject(t, testEval("let len = 5; len"), 5)
+	expected := []string{"warning: len shadows a builtin function"}
+	if fmt.Sprint(Warnings()) != fmt.Sprint(expected) {
+		t.Errorf("warnings wrong. expected=%q, got=%q", expected, Warnings())
+	}
+
+	testIntegerObject(t, testEval("let [sum, count] = [1, 2]; sum + count"), 3)
+	if len(Warnings()) != 2 {
+		t.Errorf("expected a warning for each shadowed builtin. got=%q", Warnings())
+	}
+
+	testIntegerObject(t, testEval("let total = 5; let f = fn(len) { len }; f(total)"), 5)
+	if len(Warnings()) != 0 {
+		t.Errorf("expected no warnings for ordinary names. got=%q", Warnings())
+	}
+
+	WarnShadowing = false
+	testEval("let len = 5;")
+	if len(Warnings()) != 0 {
+		t.Errorf("expected no warnings while disabled. got=%q", Warnings())
+	}
+}
+
+func TestMinOfAndMaxOf(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`minOf([3, 1, 2])`, 1},
+		{`maxOf([3, 1, 2])`, 3},
+		{`minOf([7])`, 7},
+		{`maxOf([1, 2.5, 2])`, 2.5},
+		{`minOf(["pear", "apple", "fig"])`, "apple"},
+		{`maxOf(["pear", "apple", "fig"])`, "pear"},
+		{`minOf(["pear", "apple", "fig"], len)`, "fig"},
+		{`maxOf(["pear", "apple", "fig"], len)`, "apple"},
+		{`maxOf([1, -5, 3], fn(x) { -x })`, -5},
+		{`maxOf(["ab", "cd"], len)`, "ab"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`minOf([])`, "array passed to `minOf` must not be empty"},
+		{`maxOf([])`, "array passed to `maxOf` must not be empty"},
+		{`minOf([1, "a"])`, "cannot order array elements: STRING and INTEGER"},
+		{`maxOf([true, false])`, "cannot order array elements: BOOLEAN and BOOLEAN"},
+		{`minOf([1, 2], fn(x) { x + "a" })`, "type mismatch: INTEGER + STRING"},
+		{`minOf(1)`, "first argument to `minOf` must be ARRAY, got INTEGER"},
+		{`maxOf([1], 1)`, "second argument to `maxOf` must be FUNCTION, got INTEGER"},
+		{`maxOf()`, "wrong number of arguments. got=0, want=1 or 2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestVariableAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 1; let b = 2; a = b = 5; a", 5},
+		{"let a = 1; let b = 2; a = b = 5; b", 5},
+		{"let a = 1; let b = 2; a = b = 5; a + b", 10},
+		{"let a = 1; let b = 2; a = (b = 5) + 1; a * 10 + b", 65},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let setX = fn(v) { x = v }; setX(9); x", 9},
+		{"let x = 1; let f = fn() { let x = 2; x = 3; x }; f() * 10 + x", 31},
+		{"let a = 0; let arr = [0]; a = arr[0] = 4; a + arr[0]", 8},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"missing = 5", "identifier not found: missing"},
+		{"let a = 1; a = b = 2", "identifier not found: b"},
+		{"let a = 1; a = missing", "identifier not found: missing"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPickAndOmit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected map[string]int64
+	}{
+		{`pick({"a": 1, "b": 2, "c": 3}, ["a", "c"])`, map[string]int64{"a": 1, "c": 3}},
+		{`pick({"a": 1, "b": 2}, ["a", "z"])`, map[string]int64{"a": 1}},
+		{`pick({"a": 1}, [])`, map[string]int64{}},
+		{`omit({"a": 1, "b": 2, "c": 3}, ["b"])`, map[string]int64{"a": 1, "c": 3}},
+		{`omit({"a": 1, "b": 2}, ["z"])`, map[string]int64{"a": 1, "b": 2}},
+		{`omit({"a": 1}, ["a"])`, map[string]int64{}},
+		{`let h = {"a": 1, "b": 2}; pick(h, ["a"]); omit(h, ["a"]); h`, map[string]int64{"a": 1, "b": 2}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		hash, ok := evaluated.(*object.Hash)
+		if !ok {
+			t.Errorf("%s is not Hash. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if len(hash.Pairs) != len(tt.expected) {
+			t.Errorf("%s has wrong number of pairs. expected=%d, got=%d", tt.input, len(tt.expected), len(hash.Pairs))
+			continue
+		}
+		for key, expected := range tt.expected {
+			pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+			if !ok {
+				t.Errorf("%s is missing key %q", tt.input, key)
+				continue
+			}
+			testIntegerObject(t, pair.Value, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`pick({}, [[1]])`, "unusable as hash key: ARRAY"},
+		{`pick([], [])`, "first argument to `pick` must be HASH, got ARRAY"},
+		{`omit({}, "a")`, "second argument to `omit` must be ARRAY, got STRING"},
+		{`omit({})`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTrueDivision(t *testing.T) {
+	original := TrueDivision
+	defer func() { TrueDivision = original }()
+
+	TrueDivision = false
+	testIntegerObject(t, testEval("5 / 2"), 2)
+	testIntegerObject(t, testEval("6 / 2"), 3)
+	testFloatObject(t, testEval("5.0 / 2"), 2.5)
+	testErrorObject(t, testEval("5 / 0"), "division by zero: 5 / 0")
+
+	TrueDivision = true
+	testFloatObject(t, testEval("5 / 2"), 2.5)
+	testFloatObject(t, testEval("6 / 2"), 3.0)
+	testFloatObject(t, testEval("-7 / 2"), -3.5)
+	testIntegerObject(t, testEval("5 // 2"), 2)
+}
+
+func TestBench(t *testing.T) {
+	original := Clock
+	defer func() { Clock = original }()
+	// Every reading of the clock is 5ms after the previous one
+	current := time.UnixMilli(1700000000000)
+	Clock = func() time.Time {
+		current = current.Add(5 * time.Millisecond)
+		return current
+	}
+
+	testIntegerObject(t, testEval(`bench(fn() { 1 + 1 }, 3)`), 5)
+
+	// Each call reads the clock once through now(), on top of bench's own two readings
+	testIntegerObject(t, testEval(`bench(fn() { now() }, 4)`), 25)
+
+	testIntegerObject(t, testEval(`let calls = 0; bench(fn() { calls++ }, 7); calls`), 7)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`bench(fn() { 1 }, 0)`, "second argument to `bench` must be positive, got 0"},
+		{`bench(fn() { 1 }, "3")`, "second argument to `bench` must be INTEGER, got STRING"},
+		{`bench(1, 3)`, "first argument to `bench` must be FUNCTION, got INTEGER"},
+		{`bench(fn(x) { x }, 1)`, "wrong number of arguments. got=0, want=1"},
+		{`bench(fn() { 1 })`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNegativeNumbersInLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"[-1, -2][0]", -1},
+		{"[-1, -2][1]", -2},
+		{"[-1][0] * 3", -3},
+		{"let arr = [1, -2, 3]; arr[1]", -2},
+		{"let add = fn(a, b) { a + b }; add(-1, -2)", -3},
+		{`{"a": -5}["a"]`, -5},
+		{`{-1: 7}[-1]`, 7},
+		{"1 - -2", 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSortedEntries(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sortedEntries({"b": 2, "c": 3, "a": 1})`, "[[a, 1], [b, 2], [c, 3]]"},
+		{`sortedEntries({10: "x", -1: "y", 2: "z"})`, "[[-1, y], [2, z], [10, x]]"},
+		{`sortedEntries({"b": 1, "ab": 2, "B": 3})`, "[[B, 3], [ab, 2], [b, 1]]"},
+		{`sortedEntries({})`, "[]"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s wrong. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`sortedEntries({true: 1})`, "keys of hash passed to `sortedEntries` must be INTEGER or STRING, got BOOLEAN"},
+		{`sortedEntries([])`, "argument to `sortedEntries` must be HASH, got ARRAY"},
+		{`sortedEntries()`, "wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// Which key is reported first depends on map order
+	evaluated := testEval(`sortedEntries({1: "a", "b": 2})`)
+	err, ok := evaluated.(*object.Error)
+	if !ok || !strings.HasPrefix(err.Message, "keys of hash passed to `sortedEntries` must all have the same type, got ") {
+		t.Errorf("expected mixed key type error. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestEqualDeep(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`equalDeep(1, 1)`, true},
+		{`equalDeep(1, 2)`, false},
+		{`equalDeep(1, 1.0)`, false},
+		{`equalDeep("a", "a")`, true},
+		{`equalDeep([1, [2, [3]]], [1, [2, [3]]])`, true},
+		{`equalDeep([1, [2, [3]]], [1, [2, [4]]])`, false},
+		{`equalDeep([1, 2], [1, 2, 3])`, false},
+		{`equalDeep({"a": [1, {"b": true}]}, {"a": [1, {"b": true}]})`, true},
+		{`equalDeep({"a": [1, {"b": true}]}, {"a": [1, {"b": false}]})`, false},
+		{`equalDeep({"a": 1}, {"b": 1})`, false},
+		{`equalDeep({"a": 1, "b": 2}, {"b": 2, "a": 1})`, true},
+		{`equalDeep([], {})`, false},
+		{`let f = fn() { 1 }; equalDeep(f, f)`, true},
+		{`equalDeep(fn() { 1 }, fn() { 1 })`, false},
+		{`[1] == [1]`, false},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(`equalDeep(1)`), "wrong number of arguments. got=1, want=2")
+}
+
+func TestAssertEqualAndAssertNotEqual(t *testing.T) {
+	passing := []string{
+		`assertEqual(1 + 2, 3)`,
+		`assertEqual([1, {"a": [2]}], [1, {"a": [2]}])`,
+		`assertNotEqual(1, 2)`,
+		`assertNotEqual([1, [2]], [1, [3]])`,
+		`assertNotEqual(1, "1")`,
+	}
+	for _, input := range passing {
+		testNullObject(t, testEval(input))
+	}
+
+	failing := []struct {
+		input    string
+		expected string
+	}{
+		{`assertEqual(1 + 1, 3)`, "assertion failed: expected 2 to equal 3"},
+		{`assertEqual([1, [2]], [1, [3]])`, "assertion failed: expected [1, [2]] to equal [1, [3]]"},
+		{`assertEqual("a", "b")`, "assertion failed: expected a to equal b"},
+		{`assertNotEqual([1], [1])`, "assertion failed: expected [1] not to equal [1]"},
+		{`assertEqual(1)`, "wrong number of arguments. got=1, want=2"},
+		{`assertNotEqual()`, "wrong number of arguments. got=0, want=2"},
+		// A failed assertion stops the rest of the program like any other error
+		{`assertEqual(1, 2); 5`, "assertion failed: expected 1 to equal 2"},
+	}
+	for _, tt := range failing {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIndexOutOfRangeErrors(t *testing.T) {
+	original := IndexOutOfRangeErrors
+	defer func() { IndexOutOfRangeErrors = original }()
+
+	IndexOutOfRangeErrors = false
+	testNullObject(t, testEval("[1, 2, 3][3]"))
+	testNullObject(t, testEval("[1, 2, 3][-1]"))
+	testIntegerObject(t, testEval("[1, 2, 3][2]"), 3)
+
+	IndexOutOfRangeErrors = true
+	testErrorObject(t, testEval("[1, 2, 3][3]"), "index out of range: 3")
+	testErrorObject(t, testEval("[1, 2, 3][-1]"), "index out of range: -1")
+	testErrorObject(t, testEval("[][0]"), "index out of range: 0")
+	testIntegerObject(t, testEval("[1, 2, 3][2]"), 3)
+	// Missing hash keys are still null
+	testNullObject(t, testEval(`{"a": 1}["b"]`))
+}
+
+func TestPrintAndPrintln(t *testing.T) {
+	var out bytes.Buffer
+	original := Out
+	Out = &out
+	defer func() { Out = original }()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`println("a", 1, [2, 3])`, "a\n1\n[2, 3]\n"},
+		{`print("a", 1, [2, 3])`, "a 1 [2, 3]"},
+		{`print("a"); print("b")`, "ab"},
+		{`println("a"); println("b")`, "a\nb\n"},
+		{`print(); println()`, ""},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		testNullObject(t, testEval(tt.input))
+		if out.String() != tt.expected {
+			t.Errorf("output of %s wrong. expected=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestEvalBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`eval("1 + 2")`, 3},
+		{`eval("let x = 5; x * 2")`, 10},
+		{`eval("let f = fn(n) { n + 1 }; f(1)") + eval("2")`, 4},
+		{"eval(`upper(\"a\")`)", "A"},
+		{"eval(`eval(\"1 + 1\") * 3`)", 6},
+		{`eval("return 3; 4")`, 3},
+		{`eval("")`, nil},
+		{`eval("let y = 1;")`, nil},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`eval("let = 1")`, "could not parse source passed to `eval`: expected next token to be IDENT, got ="},
+		{`eval("1 + true")`, "type mismatch: INTEGER + BOOLEAN"},
+		{`let x = 1; eval("x")`, "identifier not found: x"},
+		{`eval(1)`, "argument to `eval` must be STRING, got INTEGER"},
+		{`eval()`, "wrong number of arguments. got=0, want=1"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+
+	original := MaxSteps
+	defer func() { MaxSteps = original }()
+	MaxSteps = 1000
+	testErrorObject(t, testEval(`let src = "let loop = fn() { loop() }; loop()"; eval(src)`), "evaluation limit exceeded")
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1 + 2)`, "(1 + 2)"},
+		{`quote(foobar)`, "foobar"},
+		{`quote(unquote(4 + 4) + 8)`, "(8 + 8)"},
+		{`let x = 8; quote(x + unquote(x))`, "(x + 8)"},
+		{`quote(unquote(true == false))`, "false"},
+		{`quote(unquote(quote(4 + 4)) * 2)`, "((4 + 4) * 2)"},
+		{`let q = quote(1 + 1); quote(unquote(q) + unquote(2.5))`, "((1 + 1) + 2.5)"},
+		{`let f = fn(x) { quote(unquote(x) + 1) }; f(1); f(2)`, "(2 + 1)"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Errorf("object is not Quote. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if quote.Node == nil {
+			t.Errorf("quote.Node is nil")
+			continue
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("quote.Node.String() wrong. expected=%q, got=%q", tt.expected, quote.Node.String())
+		}
+	}
+
+	testErrorObject(t, testEval(`quote(1, 2)`), "wrong number of arguments. got=2, want=1")
+	testErrorObject(t, testEval(`quote(unquote(missing))`), "identifier not found: missing")
+	testErrorObject(t, testEval(`quote(unquote(1 + true) + unquote(missing))`), "type mismatch: INTEGER + BOOLEAN")
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func TestQuoteKeepsPositions(t *testing.T) {
+	evaluated := testEval("let x = 1;\nquote(x + 2)")
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("object is not Quote. got=%T (%+v)", evaluated, evaluated)
+	}
+	infix, ok := quote.Node.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("quote.Node is not InfixExpression. got=%T", quote.Node)
+	}
+	if infix.Token.Line != 2 || infix.Token.Column != 9 {
+		t.Errorf("quoted code lost its position. expected=2:9, got=%d:%d", infix.Token.Line, infix.Token.Column)
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+	if _, ok := env.Get("number"); ok {
+		t.Errorf("number should not be defined")
+	}
+	if _, ok := env.Get("function"); ok {
+		t.Errorf("function should not be defined")
+	}
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment")
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+	if len(macro.Parameters) != 2 || macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Fatalf("macro parameters wrong. got=%v", macro.Parameters)
+	}
+	if macro.Body.String() != "(x + y)" {
+		t.Fatalf("macro body wrong. got=%q", macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); }; infixExpression();`,
+			`(1 + 2)`,
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); }; reverse(2 + 2, 10 - 5);`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`let unless = macro(cond, body) { quote(if (!(unquote(cond))) { unquote(body); }); };
+			unless(10 > 5, puts("not greater"));`,
+			`if (!(10 > 5)) { puts("not greater") }`,
+		},
+		{
+			`let double = macro(x) { let mk = fn(y) { quote(unquote(y) * 2) }; return mk(x); }; double(1 + 2);`,
+			`(1 + 2) * 2`,
+		},
+	}
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Errorf("ExpandMacros(%s) returned error: %s", tt.input, err)
+			continue
+		}
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro(x) { 1 }; m(2);`, "macro must return QUOTE, got INTEGER"},
+		{`let m = macro(x) { quote(x) }; m();`, "wrong number of arguments to macro. got=0, want=1"},
+		{`let m = macro() { 1 + true }; m();`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range errors {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %s. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestUnlessMacro(t *testing.T) {
+	input := `
+	let unless = macro(cond, body) { quote(if (!(unquote(cond))) { unquote(body); }); };
+	let x = 0;
+	unless(10 > 5, x = 1);
+	unless(10 < 5, x = x + 2);
+	x;
+	`
+	program := testParseProgram(input)
+	env := object.NewEnvironment()
+	DefineMacros(program, env)
+	expanded, err := ExpandMacros(program, env)
+	if err != nil {
+		t.Fatalf("ExpandMacros returned error: %s", err)
+	}
+	testIntegerObject(t, Eval(expanded, env), 2)
+
+	testErrorObject(t, testEval(`let m = macro() { quote(1) }; 1`), "macros must be defined with a top-level let statement")
+	testIntegerObject(t, testEval("eval(`let twice = macro(x) { quote(unquote(x) * 2) }; twice(21)`)"), 42)
+}
+
+func TestLocalsBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let x = 1; let y = "two"; locals()["x"]`, 1},
+		{`let x = 1; let y = "two"; locals()["y"]`, "two"},
+		{`let x = 1; let y = "two"; len(locals())`, 2},
+		{`len(locals())`, 0},
+		{`let x = 1; let f = fn(a) { let b = a + 1; locals() }; f(5)["b"]`, 6},
+		{`let x = 1; let f = fn(a) { locals() }; len(f(5))`, 1},
+		{`let x = 1; let f = fn(a) { locals() }; f(5)["x"]`, nil},
+		{`let locals = fn() { 7 }; locals()`, 7},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	testErrorObject(t, testEval(`locals(1)`), "wrong number of arguments. got=1, want=0")
+}
+
+func TestCallByNameBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let add = fn(a, b) { a + b }; callByName("add", [1, 2])`, 3},
+		{`let f = fn() { let double = fn(x) { x * 2 }; callByName("double", [21]) }; f()`, 42},
+		{`callByName("upper", ["abc"])`, "ABC"},
+		{`let x = 5; callByName("locals", [])["x"]`, 5},
+		{`let handlers = ["inc"]; let inc = fn(x) { x + 1 }; callByName(handlers[0], [9])`, 10},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`callByName("missing", [])`, "identifier not found: missing"},
+		{`let x = 1; callByName("x", [])`, "`x` is not a function, got INTEGER"},
+		{`let add = fn(a, b) { a + b }; callByName("add", [1])`, "wrong number of arguments. got=1, want=2"},
+		{`callByName(1, [])`, "first argument to `callByName` must be STRING, got INTEGER"},
+		{`callByName("len", 1)`, "second argument to `callByName` must be ARRAY, got INTEGER"},
+		{`callByName("len")`, "wrong number of arguments. got=1, want=2"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
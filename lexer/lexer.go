@@ -3,7 +3,12 @@
 // This is a basic and common implementation of a lexer used in many languages
 package lexer
 
-import "github.com/ajtroup1/clearv2/token"
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/ajtroup1/clearv2/token"
+)
 
 // Lexer struct contains the data necessary for lexical analysis
 // input: The entire source code to be tokenized
@@ -15,17 +20,27 @@ type Lexer struct {
 	position     int    // Current position in the input string
 	readPosition int    // Next position to read in the input string
 	ch           byte   // Current character under examination
+	line         int    // Line of the current character, starting at 1
+	lineStart    int    // Position in the input where the current line starts
+	source       int    // ID of the input, recorded on every token
 }
 
+// Counts the lexers created, so each one's input gets its own ID
+var sourceCount atomic.Int64
+
 // Creates a new Lexer instance with the given source code
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1, source: int(sourceCount.Add(1))}
 	l.readChar() // Initialize the first character
 	return l
 }
 
 // Reads the next character from the input string and updates the lexer state
 func (l *Lexer) readChar() {
+	if l.ch == '\n' { // Moving past a newline starts the next line
+		l.line++
+		l.lineStart = l.readPosition
+	}
 	if l.readPosition >= len(l.input) { // Check if the end of input is reached
 		l.ch = 0 // Null character indicating end of input
 	} else {
@@ -35,11 +50,24 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1         // Move to the next character
 }
 
-// Returns the next token from the input stream
+// Returns the next token from the input stream, along with the line & column it starts at
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhitespace() // Skip any whitespace characters
+	line, column := l.line, l.position-l.lineStart+1
+	tok := l.readToken()
+	tok.Line, tok.Column, tok.Source = line, column, l.source
+	return tok
+}
+
+// Returns the ID recorded on the tokens of this lexer's input
+// Two lexers never share an ID, even when given the same input
+func (l *Lexer) Source() int {
+	return l.source
+}
+
+// Reads the token starting at the current character
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	// Tokenize based on the current character
 	switch l.ch {
@@ -48,13 +76,29 @@ func (l *Lexer) NextToken() token.Token {
 			ch := l.ch
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' { // Check for arrow "=>"
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch) // Single '='
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '+' { // Check for increment "++"
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.INC, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.PLUS, l.ch) // Single '+'
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '-' { // Check for decrement "--"
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.DEC, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.MINUS, l.ch) // Single '-'
+		}
 	case '!':
 		if l.peekChar() == '=' { // Check for counter-comparison "!="
 			ch := l.ch
@@ -63,18 +107,58 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.BANG, l.ch) // Single '!'
 		}
+	case '|':
+		if l.peekChar() == '>' { // Check for pipe "|>"
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.PIPE, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch) // A lone '|' isn't an operator
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '/' { // Check for floor division "//"
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.FLOORDIV, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.SLASH, l.ch) // Single '/'
+		}
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' { // Check for less-than-or-equal "<="
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.LT, l.ch) // Single '<'
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' { // Check for greater-than-or-equal ">="
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.GT, l.ch) // Single '>'
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '.':
+		tok = newToken(token.DOT, l.ch)
+	case '"':
+		tok.Type = token.STRING
+		literal, interpolated := l.readString() // Read the contents between the quotes
+		if interpolated {
+			tok.Type = token.TEMPLATE
+		}
+		tok.Literal = literal
+	case '`':
+		tok.Type = token.STRING
+		tok.Literal = l.readRawString() // Read the contents between the backticks
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -83,6 +167,10 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF // End of file
@@ -92,9 +180,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal) // Lookup identifier token type
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT         // Integer literal
-			tok.Literal = l.readNumber() // Read the number
-			return tok
+			return l.readNumberToken() // Integer or float literal
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch) // Illegal character
 		}
@@ -132,6 +218,30 @@ func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
 
+// Reads an integer or float literal from the input
+// A number is a float when its digits are followed by a '.' and more digits ("1.5"), or by an exponent ("1.5e3", "2E-2")
+// A '.' that isn't followed by a digit is left alone, so "5.len()" is still an integer followed by a method call
+// An exponent without digits ("1e") is still read as part of the float, so the parser reports it as malformed
+func (l *Lexer) readNumberToken() token.Token {
+	position := l.position // Start position of the number
+	tokenType := token.TokenType(token.INT)
+	l.readNumber()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		l.readChar() // Consume the '.'
+		l.readNumber()
+		tokenType = token.FLOAT
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		l.readChar() // Consume the 'e'
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		l.readNumber()
+		tokenType = token.FLOAT
+	}
+	return token.Token{Type: tokenType, Literal: l.input[position:l.position]}
+}
+
 // Reads a sequence of digits from the input
 func (l *Lexer) readNumber() string {
 	position := l.position // Start position of the number
@@ -141,6 +251,57 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position] // Return the number
 }
 
+// Reads a string literal from the input, starting at the opening quote
+// Returns the contents between the quotes. An unterminated string ends at the end of the input
+// When the string contains an interpolation ("${name}"), its contents are returned as written for the parser to split, and interpolated is true
+// Otherwise the escaped "\${" is replaced by a literal "${"
+func (l *Lexer) readString() (literal string, interpolated bool) {
+	position := l.position + 1 // Start position of the string's contents, after the opening quote
+	for {
+		l.readChar() // Move to the next character
+		if l.ch == '\\' && strings.HasPrefix(l.input[l.readPosition:], "${") {
+			l.readChar() // Skip the escaped '$' so it doesn't start an interpolation
+			continue
+		}
+		if l.ch == '$' && l.peekChar() == '{' {
+			// Skip the embedded expression, since it may contain quotes of its own: "${upper("a")}"
+			interpolated = true
+			end := interpolationEnd(l.input, l.readPosition+1)
+			if end == -1 {
+				end = len(l.input)
+			}
+			for l.position < end {
+				l.readChar()
+			}
+			if l.ch == 0 {
+				break
+			}
+			continue
+		}
+		if l.ch == '"' || l.ch == 0 {
+			break
+		}
+	}
+	literal = l.input[position:l.position] // The contents
+	if !interpolated {
+		literal = strings.ReplaceAll(literal, "\\${", "${")
+	}
+	return literal, interpolated
+}
+
+// Reads a raw string literal from the input, starting at the opening backtick
+// Returns the contents between the backticks exactly as written, including newlines. An unterminated string ends at the end of the input
+func (l *Lexer) readRawString() string {
+	position := l.position + 1 // Start position of the string's contents, after the opening backtick
+	for {
+		l.readChar()
+		if l.ch == '`' || l.ch == 0 {
+			break
+		}
+	}
+	return l.input[position:l.position]
+}
+
 // Determines if the given character is a digit
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
@@ -29,6 +29,17 @@ func TestNextToken(t *testing.T) {
 	}
 	10 == 10;
 	10 != 9;
+	[1, 2];
+	"foobar"
+	"foo bar"
+	{"foo": "bar"}
+	name.len()
+	1.5 + 10.25;
+	x |> f;
+	7 // 2 / 1;
+	(x) => x;
+	1 <= 2 >= 3;
+	++i--;
 	`
 
 	tests := []struct {
@@ -108,6 +119,54 @@ func TestNextToken(t *testing.T) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "name"},
+		{token.DOT, "."},
+		{token.IDENT, "len"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.FLOAT, "1.5"},
+		{token.PLUS, "+"},
+		{token.FLOAT, "10.25"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "f"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "7"},
+		{token.FLOORDIV, "//"},
+		{token.INT, "2"},
+		{token.SLASH, "/"},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "x"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "1"},
+		{token.LT_EQ, "<="},
+		{token.INT, "2"},
+		{token.GT_EQ, ">="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.INC, "++"},
+		{token.IDENT, "i"},
+		{token.DEC, "--"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 	// [...]
@@ -127,3 +186,165 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestRawStrings(t *testing.T) {
+	input := "let template = `<p class=\"greeting\">\n\tHello, ${name}\\n\n</p>`;\n`unterminated"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "template"},
+		{token.ASSIGN, "="},
+		{token.STRING, "<p class=\"greeting\">\n\tHello, ${name}\\n\n</p>"},
+		{token.SEMICOLON, ";"},
+		{token.STRING, "unterminated"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := `"Hello, ${name}!" "${upper("a}")} and ${ {"k": 1}["k"] }" "costs \${5}" "plain"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TEMPLATE, "Hello, ${name}!"},
+		{token.TEMPLATE, `${upper("a}")} and ${ {"k": 1}["k"] }`},
+		{token.STRING, "costs ${5}"},
+		{token.STRING, "plain"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestSplitTemplate(t *testing.T) {
+	parts, err := SplitTemplate(`Hi ${name}, \${not} ${a + b}`)
+	if err != nil {
+		t.Fatalf("SplitTemplate returned error: %s", err)
+	}
+	expected := []TemplatePart{
+		{Text: "Hi "},
+		{Text: "name", Interpolated: true},
+		{Text: ", ${not} "},
+		{Text: "a + b", Interpolated: true},
+	}
+	if len(parts) != len(expected) {
+		t.Fatalf("wrong number of parts. expected=%d, got=%d (%+v)", len(expected), len(parts), parts)
+	}
+	for i, part := range parts {
+		if part != expected[i] {
+			t.Errorf("parts[%d] wrong. expected=%+v, got=%+v", i, expected[i], part)
+		}
+	}
+
+	if _, err := SplitTemplate(`Hi ${name`); err == nil {
+		t.Errorf("expected an error for an unterminated interpolation")
+	}
+}
+
+func TestScientificNotation(t *testing.T) {
+	input := `1.5e3 2E-2 3e+4 7 1e 5.len()`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "1.5e3"},
+		{token.FLOAT, "2E-2"},
+		{token.FLOAT, "3e+4"},
+		{token.INT, "7"},
+		{token.FLOAT, "1e"}, // Malformed, and rejected by the parser
+		{token.INT, "5"},
+		{token.DOT, "."},
+		{token.IDENT, "len"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenSources(t *testing.T) {
+	first, second := New("let x = 5;"), New("let x = 5;")
+	if first.Source() == second.Source() {
+		t.Fatalf("lexers share source ID %d", first.Source())
+	}
+	for tok := first.NextToken(); tok.Type != token.EOF; tok = first.NextToken() {
+		if tok.Source != first.Source() {
+			t.Errorf("token %q has wrong source. expected=%d, got=%d", tok.Literal, first.Source(), tok.Source)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"a b\"\n\n\tfoo"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"a b", 2, 7},
+		{"foo", 4, 2},
+		{"", 4, 5},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%d:%d, got=%d:%d",
+				i, tok.Literal, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A piece of an interpolated string: either literal text, or the source of an embedded expression
+type TemplatePart struct {
+	Text         string
+	Interpolated bool // Whether Text is the source of an expression from "${...}"
+}
+
+// Splits the contents of a token.TEMPLATE string into its literal text and embedded expressions
+// "Hello, ${name}!" becomes "Hello, ", the expression "name", and "!". The escaped "\${" is kept as a literal "${"
+func SplitTemplate(contents string) ([]TemplatePart, error) {
+	parts := []TemplatePart{}
+	var text strings.Builder
+	for i := 0; i < len(contents); i++ {
+		if strings.HasPrefix(contents[i:], "\\${") {
+			text.WriteString("${")
+			i += 2
+			continue
+		}
+		if !strings.HasPrefix(contents[i:], "${") {
+			text.WriteByte(contents[i])
+			continue
+		}
+
+		end := interpolationEnd(contents, i+2)
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated interpolation in string %q", contents)
+		}
+		if text.Len() > 0 {
+			parts = append(parts, TemplatePart{Text: text.String()})
+			text.Reset()
+		}
+		parts = append(parts, TemplatePart{Text: contents[i+2 : end], Interpolated: true})
+		i = end
+	}
+	if text.Len() > 0 {
+		parts = append(parts, TemplatePart{Text: text.String()})
+	}
+	return parts, nil
+}
+
+// Returns the index of the '}' closing an interpolation whose expression starts at start, or -1 if it's never closed
+// Braces inside the expression are matched, and quoted strings are skipped, so "${ {"a": "}"}["a"] }" ends at the last brace
+func interpolationEnd(input string, start int) int {
+	depth := 1
+	for i := start; i < len(input); i++ {
+		switch input[i] {
+		case '"':
+			closing := strings.IndexByte(input[i+1:], '"')
+			if closing == -1 {
+				return -1
+			}
+			i += closing + 1
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -6,14 +6,48 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
 
+	"github.com/ajtroup1/clearv2/evaluator"
+	"github.com/ajtroup1/clearv2/object"
 	"github.com/ajtroup1/clearv2/repl"
 )
 
 func main() {
+	// Debugging flags that print a stage of the pipeline and exit without evaluating
+	dumpTokens := flag.Bool("tokens", false, "print the token stream and exit without evaluating")
+	dumpAST := flag.Bool("ast", false, "print the parsed program and exit without evaluating")
+	warn := flag.Bool("warn", false, "warn when a let shadows a builtin function")
+	flag.Parse()
+	evaluator.WarnShadowing = *warn
+
+	if *dumpTokens || *dumpAST {
+		// Read the source from the file argument, or stdin if there isn't one: "clear --ast script.clr"
+		source, err := readSource(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if *dumpTokens {
+			repl.DumpTokens(os.Stdout, source)
+			return
+		}
+		if errors := repl.DumpAST(os.Stdout, source); len(errors) != 0 {
+			printErrors(errors)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// A file argument runs that file instead of starting the REPL: "clear script.clr"
+	if flag.NArg() > 0 {
+		os.Exit(runFile(flag.Arg(0)))
+	}
+
 	// Retreives current user's name. Not necessary at all, but hey
 	user, err := user.Current()
 	if err != nil {
@@ -25,3 +59,47 @@ func main() {
 	// Initiate the REPL to execute commands in Clear
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// Runs the Clear source file at the given path and returns the process exit status
+// Unlike the REPL, parser and runtime errors are fatal: they're printed to stderr and the status is non-zero
+func runFile(path string) int {
+	source, err := readSource(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	evaluated, errors := repl.Run(source, object.NewEnvironment())
+	if len(errors) != 0 {
+		printErrors(errors)
+		return 1
+	}
+	for _, warning := range evaluator.Warnings() {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+	if err, ok := evaluated.(*object.Error); ok {
+		fmt.Fprint(os.Stderr, repl.FormatError(source, err))
+		return 1
+	}
+	return 0
+}
+
+// Returns the contents of the file at the given path, or all of stdin if the path is empty
+func readSource(path string) (string, error) {
+	var source []byte
+	var err error
+	if path == "" {
+		source, err = io.ReadAll(os.Stdin)
+	} else {
+		source, err = os.ReadFile(path)
+	}
+	return string(source), err
+}
+
+// Prints parser errors to stderr
+func printErrors(errors []string) {
+	fmt.Fprintln(os.Stderr, "parser errors:")
+	for _, msg := range errors {
+		fmt.Fprintln(os.Stderr, "\t"+msg)
+	}
+}
@@ -1,24 +1,88 @@
 package object
 
+import "sort"
+
 // Instantiates & returns a new instance of Environment
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s}
+	return &Environment{store: s, outer: nil}
+}
+
+// Instantiates a new Environment enclosed by an outer one
+// Used when calling functions so that parameters don't overwrite the caller's bindings
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
 }
 
 // Our environment struct contains the entire environment 'tool'
 // Environment is just a fancy way to associate strings with objects
 // For now, we can just use a hashmap to associate these
+// An environment can be enclosed by an outer one. Lookups fall back to the outer environment when a name isn't found locally
 type Environment struct {
 	store map[string]Object
+	outer *Environment
 }
 
 // Simple getters and setters for manipulating environment vars
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
 	return obj, ok
 }
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Rebinds an existing name in the environment that defines it, which may be an outer one
+// Returns false without binding anything when the name isn't defined anywhere
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a shallow copy of the local bindings, so they can be rolled back with Restore
+// Only this environment's store is copied. Outer environments aren't snapshotted
+func (e *Environment) Snapshot() map[string]Object {
+	snapshot := make(map[string]Object, len(e.store))
+	for name, val := range e.store {
+		snapshot[name] = val
+	}
+	return snapshot
+}
+
+// Replaces the local bindings with those from a previous Snapshot
+// Names bound after the snapshot was taken are removed
+func (e *Environment) Restore(snapshot map[string]Object) {
+	store := make(map[string]Object, len(snapshot))
+	for name, val := range snapshot {
+		store[name] = val
+	}
+	e.store = store
+}
+
+// Returns every name visible from this environment, including those bound in outer environments, in alphabetical order
+// A name bound in more than one scope is only listed once
+func (e *Environment) AllNames() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
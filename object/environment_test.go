@@ -0,0 +1,90 @@
+package object
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	env := NewEnvironment()
+	env.Set("a", &Integer{Value: 1})
+	env.Set("b", &Integer{Value: 2})
+
+	snapshot := env.Snapshot()
+
+	env.Set("a", &Integer{Value: 10})
+	env.Set("c", &Integer{Value: 3})
+
+	env.Restore(snapshot)
+
+	a, ok := env.Get("a")
+	if !ok || a.(*Integer).Value != 1 {
+		t.Errorf("a not restored. got=%v", a)
+	}
+	b, ok := env.Get("b")
+	if !ok || b.(*Integer).Value != 2 {
+		t.Errorf("b not restored. got=%v", b)
+	}
+	if _, ok := env.Get("c"); ok {
+		t.Errorf("c should not exist after restore")
+	}
+
+	// Mutating after a restore must not leak back into the snapshot
+	env.Set("d", &Integer{Value: 4})
+	if _, ok := snapshot["d"]; ok {
+		t.Errorf("snapshot was modified by later bindings")
+	}
+}
+
+func TestSnapshotIsLocalOnly(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("y", &Integer{Value: 2})
+
+	snapshot := inner.Snapshot()
+	if _, ok := snapshot["x"]; ok {
+		t.Errorf("snapshot should not include outer bindings")
+	}
+
+	outer.Set("x", &Integer{Value: 5})
+	inner.Restore(snapshot)
+
+	x, _ := inner.Get("x")
+	if x.(*Integer).Value != 5 {
+		t.Errorf("outer bindings should not be restored. got=%d", x.(*Integer).Value)
+	}
+}
+
+func TestAllNames(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("x", &Integer{Value: 1})
+	global.Set("f", &Integer{Value: 2})
+	outer := NewEnclosedEnvironment(global)
+	outer.Set("y", &Integer{Value: 3})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("x", &Integer{Value: 4}) // Shadows the global x
+	inner.Set("z", &Integer{Value: 5})
+
+	tests := []struct {
+		env      *Environment
+		expected []string
+	}{
+		{inner, []string{"f", "x", "y", "z"}},
+		{outer, []string{"f", "x", "y"}},
+		{global, []string{"f", "x"}},
+		{NewEnvironment(), []string{}},
+	}
+	for _, tt := range tests {
+		names := tt.env.AllNames()
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("wrong names. expected=%v, got=%v", tt.expected, names)
+		}
+	}
+
+	// The shadowing binding is the one that's visible
+	x, _ := inner.Get("x")
+	if x.(*Integer).Value != 4 {
+		t.Errorf("x should resolve to the inner binding. got=%d", x.(*Integer).Value)
+	}
+}
@@ -0,0 +1,63 @@
+package object
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.0, "3.0"},
+		{1.5, "1.5"},
+		{0.1, "0.1"},
+		{-2.0, "-2.0"},
+		{0, "0.0"},
+		{1.25, "1.25"},
+		{100, "100.0"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("Float{%v}.Inspect() wrong. expected=%q, got=%q",
+				tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestOnlyValueTypesAreHashable(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		hashable bool
+	}{
+		{&Integer{Value: 1}, true},
+		{&Boolean{Value: true}, true},
+		{&String{Value: "a"}, true},
+		{&Float{Value: 1.5}, false},
+		{&Array{}, false},
+		{&Hash{}, false},
+		{&Function{}, false},
+		{&Builtin{}, false},
+		{&Null{}, false},
+	}
+	for _, tt := range tests {
+		if _, ok := tt.obj.(Hashable); ok != tt.hashable {
+			t.Errorf("%s hashable wrong. expected=%t, got=%t", tt.obj.Type(), tt.hashable, ok)
+		}
+	}
+}
+
+func TestReturnValueDelegatesToWrappedValue(t *testing.T) {
+	rv := &ReturnValue{Value: &String{Value: "done"}}
+	if rv.Type() != RETURN_VALUE_OBJ {
+		t.Errorf("ReturnValue.Type() wrong. expected=%q, got=%q", RETURN_VALUE_OBJ, rv.Type())
+	}
+	if rv.Inspect() != "done" {
+		t.Errorf("ReturnValue.Inspect() wrong. expected=%q, got=%q", "done", rv.Inspect())
+	}
+}
@@ -16,25 +16,37 @@ import (
 const (
 	_           int = iota
 	LOWEST          // Lowest precedence level, used as a base
+	ASSIGN          // Precedence level for '='
+	PIPE            // Precedence level for '|>'
 	EQUALS          // Precedence level for '==' and '!='
 	LESSGREATER     // Precedence level for '<' and '>'
 	SUM             // Precedence level for '+' and '-'
 	PRODUCT         // Precedence level for '*' and '/'
 	PREFIX          // Precedence level for prefix operators like '-X' or '!X'
 	CALL            // Precedence level for function calls like 'myFunction(X)'
+	INDEX           // Precedence level for index access like 'myArray[X]'
 )
 
 // Maps tokens to their corresponding precedence levels
 var precedences = map[token.TokenType]int{ // Precedence table
+	token.ASSIGN:   ASSIGN,
+	token.PIPE:     PIPE,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
+	token.FLOORDIV: PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+	token.INC:      INDEX,
+	token.DEC:      INDEX,
 }
 
 type (
@@ -76,25 +88,43 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE, p.parseTemplateStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.PLUS, p.parsePrefixExpression)
+	p.registerPrefix(token.INC, p.parsePrefixIncrement)
+	p.registerPrefix(token.DEC, p.parsePrefixIncrement)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseBraceExpression)
 
 	// Register all infix parsing functions
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
+	p.registerInfix(token.FLOORDIV, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMethodCallExpression)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.INC, p.parsePostfixIncrement)
+	p.registerInfix(token.DEC, p.parsePostfixIncrement)
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -118,8 +148,12 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 	for !p.curTokenIs(token.EOF) { // Loop until the end of input
+		errorCount := len(p.errors)
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if len(p.errors) > errorCount {
+			// Skip the rest of the bad statement, so its leftover tokens don't cause errors of their own
+			p.synchronize()
+		} else if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
@@ -128,6 +162,14 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 }
 
+// Recovers from a parse error by skipping tokens until the end of the statement: a ";" or "}"
+// Parsing resumes with the next statement, so independent errors in one program are all reported
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		p.nextToken()
+	}
+}
+
 // Parses and identifier and returns it as an expression node
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
@@ -137,6 +179,9 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
+		if p.peekTokenIs(token.LBRACKET) {
+			return p.parseDestructuringStatement()
+		}
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
@@ -167,6 +212,31 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// Parses a let statement binding several names to an array's elements: "let [a, b] = [1, 2];"
+func (p *Parser) parseDestructuringStatement() ast.Statement {
+	stmt := &ast.DestructuringStatement{Token: p.curToken} // Let token
+	p.nextToken()                                          // "["
+	for !p.peekTokenIs(token.RBRACKET) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken() // "]"
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken} // Return token
 	p.nextToken()
@@ -226,6 +296,60 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// Parses a float literal and returns it as an expression node
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	lit.Value = value
+	return lit
+}
+
+// Parses a string literal and returns it as an expression node
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// Parses a string containing interpolations: "Hello, ${name}!"
+// Each embedded expression is parsed on its own, and must be a single expression
+func (p *Parser) parseTemplateStringLiteral() ast.Expression {
+	template := &ast.TemplateStringLiteral{Token: p.curToken}
+	parts, err := lexer.SplitTemplate(p.curToken.Literal)
+	if err != nil {
+		p.errors = append(p.errors, err.Error())
+		return nil
+	}
+
+	for _, part := range parts {
+		if !part.Interpolated {
+			text := token.Token{Type: token.STRING, Literal: part.Text}
+			template.Parts = append(template.Parts, &ast.StringLiteral{Token: text, Value: part.Text})
+			continue
+		}
+
+		inner := New(lexer.New(part.Text))
+		program := inner.ParseProgram()
+		if len(inner.Errors()) != 0 {
+			p.errors = append(p.errors, inner.Errors()...)
+			return nil
+		}
+		var stmt *ast.ExpressionStatement
+		if len(program.Statements) == 1 {
+			stmt, _ = program.Statements[0].(*ast.ExpressionStatement)
+		}
+		if stmt == nil {
+			p.errors = append(p.errors, fmt.Sprintf("interpolation must be a single expression, got %q", part.Text))
+			return nil
+		}
+		template.Parts = append(template.Parts, stmt.Expression)
+	}
+	return template
+}
+
 // Parses an expression with a prefix operator: "!", "-"
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
@@ -269,18 +393,58 @@ func (p *Parser) parseBoolean() ast.Expression {
 }
 
 // Parses an expression encased in parentheses
+// Also parses arrow functions, whose parameter list looks like a parenthesized expression until the "=>" after it: "(x) => x * 2"
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	if p.peekTokenIs(token.RPAREN) { // "()" can only be an arrow function without parameters
+		p.nextToken()
+		return p.parseArrowFunction([]ast.Expression{})
+	}
+
 	// Advance past open parenthesis
 	p.nextToken()
 
 	// Parse the expression inside the parentheses
 	exp := p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COMMA) { // A comma separated list can only be an arrow function's parameters
+		p.nextToken()
+		params := append([]ast.Expression{exp}, p.parseExpressionList(token.RPAREN)...)
+		return p.parseArrowFunction(params)
+	}
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	if p.peekTokenIs(token.ARROW) {
+		return p.parseArrowFunction([]ast.Expression{exp})
+	}
 	return exp
 }
 
+// Parses the rest of an arrow function after its parameter list, which has already been parsed as expressions
+// The single expression body becomes a function body returning it, so "(x) => x * 2" is the same as "fn(x) { return x * 2; }"
+func (p *Parser) parseArrowFunction(params []ast.Expression) ast.Expression {
+	// The literal gets an "fn" token, so it prints the same as the equivalent fn literal
+	lit := &ast.FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn"}, Parameters: []*ast.Identifier{}}
+	for _, param := range params {
+		ident, ok := param.(*ast.Identifier)
+		if !ok {
+			msg := fmt.Sprintf("arrow function parameters must be identifiers, got %s", param)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		lit.Parameters = append(lit.Parameters, ident)
+	}
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	arrow := p.curToken
+
+	p.nextToken()
+	ret := &ast.ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}}
+	ret.ReturnValue = p.parseExpression(LOWEST)
+	lit.Body = &ast.BlockStatement{Token: arrow, Statements: []ast.Statement{ret}}
+	return lit
+}
+
 // Parses an if expression: "if (condition) {x}" and returns an expression
 func (p *Parser) parseIfExpression() ast.Expression {
 	// Instantiate if expression token
@@ -327,6 +491,12 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	// Initialize the list of statements contained in the block
 	block.Statements = []ast.Statement{}
 	p.nextToken()
+	p.parseBlockStatements(block)
+	return block
+}
+
+// Parses statements into the block until the closing brace, starting from the current token
+func (p *Parser) parseBlockStatements(block *ast.BlockStatement) {
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) { // As long as the token isn't the end of the block "}" or the end of the file (illegal)
 		// Parse the statement and add it to the list of statements in the block
 		stmt := p.parseStatement()
@@ -335,7 +505,6 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
-	return block
 }
 
 // Parses a function literal expression
@@ -357,6 +526,20 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+// Parses a macro literal, which is written like a function literal: "macro(x, y) { quote(x + y) }"
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	lit.Body = p.parseBlockStatement()
+	return lit
+}
+
 // Parses the parameter list as a slice of identifier for a function literal
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
@@ -391,32 +574,197 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	// Instantiate a call expression with a given function
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	// Parse the arguments list
-	exp.Arguments = p.parseCallArguments()
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
 	return exp
 }
 
-// Parses the list of function call arguments and returns them as a slice of expression
-// Works similarly to parseFunctionParameters() above
-func (p *Parser) parseCallArguments() []ast.Expression {
+// Parses a comma separated list of expressions closed by the given end token and returns them as a slice
+// Used for both function call arguments "(1, 2)" and array elements "[1, 2]"
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	// Instantiate the slice
-	args := []ast.Expression{}
-	// Arguments list must be encased in parentheses
-	if p.peekTokenIs(token.RPAREN) {
+	list := []ast.Expression{}
+	// Check if the list is empty (end token immediately follows the opening token)
+	if p.peekTokenIs(end) {
 		p.nextToken()
-		// If not, return the empty slice
-		return args
+		// If so, return the empty slice
+		return list
 	}
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
-	for p.peekTokenIs(token.COMMA) { // Continue through comma separated list and parse the individual arguments
+	list = append(list, p.parseExpression(LOWEST))
+	for p.peekTokenIs(token.COMMA) { // Continue through comma separated list and parse the individual expressions
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
 	}
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(end) {
+		return nil
+	}
+	return list
+}
+
+// Parses an array literal: "[1, 2, 3]"
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+// Parses an index expression: "myArray[1]"
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	// Advance past the '[' and parse the index
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	// The index must be closed by a ']'
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return exp
+}
+
+// Parses a method call on a receiver: ""hello".upper()", "name.len()"
+func (p *Parser) parseMethodCallExpression(receiver ast.Expression) ast.Expression {
+	exp := &ast.MethodCallExpression{Token: p.curToken, Receiver: receiver}
+
+	// The method name follows the dot
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Method = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// Followed by the argument list, which is required even when empty
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	return exp
+}
+
+// Parses an increment or decrement before a variable: "++i", "--i"
+func (p *Parser) parsePrefixIncrement() ast.Expression {
+	expression := &ast.IncrementExpression{Token: p.curToken, Operator: p.curToken.Literal, Prefix: true}
+	p.nextToken()
+	operand := p.parseExpression(PREFIX)
+	name, ok := operand.(*ast.Identifier)
+	if !ok {
+		p.invalidIncrementError(expression.Operator, operand)
+		return nil
+	}
+	expression.Name = name
+	return expression
+}
+
+// Parses an increment or decrement after a variable: "i++", "i--"
+func (p *Parser) parsePostfixIncrement(operand ast.Expression) ast.Expression {
+	name, ok := operand.(*ast.Identifier)
+	if !ok {
+		p.invalidIncrementError(p.curToken.Literal, operand)
+		return nil
+	}
+	return &ast.IncrementExpression{Token: p.curToken, Operator: p.curToken.Literal, Name: name}
+}
+
+// Records an error for an increment or decrement applied to something other than a variable
+func (p *Parser) invalidIncrementError(operator string, operand ast.Expression) {
+	got := "nothing"
+	if operand != nil {
+		got = operand.String()
+	}
+	p.errors = append(p.errors, fmt.Sprintf("%s can only be applied to a variable, got %s", operator, got))
+}
+
+// Parses an assignment to a variable or to an element of an array or hash: "x = 5", "arr[1] = 99"
+// Assignment is right-associative, so the value is parsed below the assignment's own precedence: "a = b = 5" is "a = (b = 5)"
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{Token: p.curToken, Target: target}
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression: // Variables & elements can be assigned to
+	default:
+		msg := fmt.Sprintf("invalid assignment target: %s", target.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+	return expression
+}
+
+// Parses a pipe, which is rewritten into the call it stands for: "x |> f" becomes "f(x)"
+// When the right side is already a call, the piped value becomes its first argument: "x |> f(y)" becomes "f(x, y)"
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+	p.nextToken()
+	right := p.parseExpression(PIPE) // Pipes are left-associative: "x |> f |> g" is "g(f(x))"
+
+	if call, ok := right.(*ast.CallExpression); ok {
+		call.Arguments = append([]ast.Expression{left}, call.Arguments...)
+		return call
+	}
+	return &ast.CallExpression{Token: tok, Function: right, Arguments: []ast.Expression{left}}
+}
+
+// Parses an expression starting with "{", which is either a hash literal or a block expression
+// "{}" is an empty hash, and a block starting with "let" or "return" can't be a hash
+// Otherwise the first expression decides: a hash if it's followed by a colon, a block if it isn't
+func (p *Parser) parseBraceExpression() ast.Expression {
+	start := p.curToken
+	if p.peekTokenIs(token.RBRACE) {
+		return p.parseHashLiteral(start, nil)
+	}
+	if p.peekTokenIs(token.LET) || p.peekTokenIs(token.RETURN) {
+		return &ast.BlockExpression{Token: start, Block: p.parseBlockStatement()}
+	}
+
+	p.nextToken()
+	first := &ast.ExpressionStatement{Token: p.curToken}
+	first.Expression = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COLON) {
+		return p.parseHashLiteral(start, first.Expression)
+	}
+
+	// The first expression was the block's first statement, so continue parsing the rest of the block after it
+	block := &ast.BlockStatement{Token: start, Statements: []ast.Statement{first}}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	p.nextToken()
+	p.parseBlockStatements(block)
+	return &ast.BlockExpression{Token: start, Block: block}
+}
+
+// Parses a hash literal: "{"one": 1, "two": 2}"
+// The first key may already have been parsed while telling the hash apart from a block, in which case it's passed as key
+func (p *Parser) parseHashLiteral(start token.Token, key ast.Expression) ast.Expression {
+	hash := &ast.HashLiteral{Token: start}
+	hash.Pairs = make(map[ast.Expression]ast.Expression)
+
+	for key != nil || !p.peekTokenIs(token.RBRACE) { // Parse pairs until the closing brace
+		if key == nil {
+			p.nextToken()
+			key = p.parseExpression(LOWEST)
+		}
+
+		// Every key must be followed by a colon and its value
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs[key] = value
+		key = nil
+
+		// Pairs are separated by commas, unless it's the last one
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
-	return args
+	return hash
 }
 
 // Check for if the CURRENT token matches the sent token type (param)
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/ajtroup1/clearv2/ast"
@@ -157,6 +158,71 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "2.5;"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 2.5 {
+		t.Errorf("literal.Value not %f. got=%f", 2.5, literal.Value)
+	}
+	if literal.TokenLiteral() != "2.5" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "2.5", literal.TokenLiteral())
+	}
+
+	logTestResult(t, true, "TestFloatLiteralExpression")
+}
+
+func TestScientificNotationFloatLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5e3;", 1500},
+		{"2E-2;", 0.02},
+		{"3e+4;", 30000},
+		{"1e0;", 1},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+
+	for _, input := range []string{"1e;", "2.5E+;"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		expected := fmt.Sprintf("could not parse %q as float", strings.TrimSuffix(input, ";"))
+		if len(p.Errors()) == 0 || p.Errors()[0] != expected {
+			t.Errorf("wrong parser errors for %s. expected=%q, got=%q", input, expected, p.Errors())
+		}
+	}
+
+	logTestResult(t, true, "TestScientificNotationFloatLiterals")
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -167,6 +233,8 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-15;", "-", 15},
 		{"!foobar;", "!", "foobar"},
 		{"-foobar;", "-", "foobar"},
+		{"+15;", "+", 15},
+		{"+foobar;", "+", "foobar"},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
 	}
@@ -215,6 +283,8 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 / 5;", 5, "/", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
@@ -263,6 +333,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"a + b // c * d",
+			"(a + ((b // c) * d))",
+		},
 		{
 			"!-a",
 			"(!(-a))",
@@ -359,6 +433,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
 	}
 	passCount := 0
 	for _, tt := range tests {
@@ -633,6 +715,797 @@ func TestCallExpressionParsing(t *testing.T) {
 	logTestResult(t, true, "TestFunctionCallParsing")
 }
 
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+
+	logTestResult(t, true, "TestParsingArrayLiterals")
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+
+	logTestResult(t, true, "TestParsingIndexExpressions")
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+
+	logTestResult(t, true, "TestStringLiteralExpression")
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+	expected := map[string]int64{
+		"one":   1,
+		"two":   2,
+		"three": 3,
+	}
+	for key, value := range hash.Pairs {
+		literal, ok := key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+		}
+		expectedValue := expected[literal.String()]
+		testIntegerLiteral(t, value, expectedValue)
+	}
+
+	logTestResult(t, true, "TestParsingHashLiteralsStringKeys")
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	logTestResult(t, true, "TestParsingEmptyHashLiteral")
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+	tests := map[string]func(ast.Expression){
+		"one": func(e ast.Expression) {
+			testInfixExpression(t, e, 0, "+", 1)
+		},
+		"two": func(e ast.Expression) {
+			testInfixExpression(t, e, 10, "-", 8)
+		},
+		"three": func(e ast.Expression) {
+			testInfixExpression(t, e, 15, "/", 5)
+		},
+	}
+	for key, value := range hash.Pairs {
+		literal, ok := key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			continue
+		}
+		testFunc, ok := tests[literal.String()]
+		if !ok {
+			t.Errorf("No test function for key %q found", literal.String())
+			continue
+		}
+		testFunc(value)
+	}
+
+	logTestResult(t, true, "TestParsingHashLiteralsWithExpressions")
+}
+
+func TestMethodCallExpressionParsing(t *testing.T) {
+	input := `"hello".len();`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MethodCallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MethodCallExpression. got=%T",
+			stmt.Expression)
+	}
+	receiver, ok := exp.Receiver.(*ast.StringLiteral)
+	if !ok || receiver.Value != "hello" {
+		t.Fatalf("exp.Receiver is not the \"hello\" string literal. got=%T (%+v)",
+			exp.Receiver, exp.Receiver)
+	}
+	if !testIdentifier(t, exp.Method, "len") {
+		return
+	}
+	if len(exp.Arguments) != 0 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`name.upper()`, `name.upper()`},
+		{`name.trim(1, 2 * 3)`, `name.trim(1, (2 * 3))`},
+		{`a.len() + b.len()`, `(a.len() + b.len())`},
+		{`-a.len()`, `(-a.len())`},
+		{`a.upper().lower()`, `a.upper().lower()`},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	logTestResult(t, true, "TestMethodCallExpressionParsing")
+}
+
+func TestBlockExpressionParsing(t *testing.T) {
+	input := `let x = { let y = 5; y * 2 };`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt := program.Statements[0].(*ast.LetStatement)
+	block, ok := stmt.Value.(*ast.BlockExpression)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.BlockExpression. got=%T", stmt.Value)
+	}
+	if len(block.Block.Statements) != 2 {
+		t.Fatalf("block does not contain 2 statements. got=%d", len(block.Block.Statements))
+	}
+	if _, ok := block.Block.Statements[0].(*ast.LetStatement); !ok {
+		t.Fatalf("block.Statements[0] is not ast.LetStatement. got=%T", block.Block.Statements[0])
+	}
+	last, ok := block.Block.Statements[1].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("block.Statements[1] is not ast.ExpressionStatement. got=%T", block.Block.Statements[1])
+	}
+	if !testInfixExpression(t, last.Expression, "y", "*", 2) {
+		return
+	}
+
+	// Blocks and hashes both start with "{", so check they're told apart
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{ x }`, `{ x }`},
+		{`{ x * 2; y }`, `{ (x * 2)y }`},
+		{`{ return x; }`, `{ return x; }`},
+		{`{ f(x); { 1 } }`, `{ f(x){ 1 } }`},
+		{`{}`, `{}`},
+		{`{ x: 1 }`, `{x:1}`},
+		{`{ x * 2: y }`, `{(x * 2):y}`},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	// Hash pairs are unordered, so a hash with several pairs is checked pair by pair rather than by its String()
+	l = lexer.New(`{ x * 2: y, "a": 1 }`)
+	p = New(l)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	hashStmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := hashStmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", hashStmt.Expression)
+	}
+	expectedPairs := map[string]string{"(x * 2)": "y", "a": "1"}
+	if len(hash.Pairs) != len(expectedPairs) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+	for key, value := range hash.Pairs {
+		expectedValue, ok := expectedPairs[key.String()]
+		if !ok {
+			t.Errorf("unexpected key in hash.Pairs: %q", key.String())
+			continue
+		}
+		if value.String() != expectedValue {
+			t.Errorf("value for key %q wrong. expected=%q, got=%q", key.String(), expectedValue, value.String())
+		}
+	}
+
+	logTestResult(t, true, "TestBlockExpressionParsing")
+}
+
+func TestPipeExpressionParsing(t *testing.T) {
+	input := `x |> f;`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, call.Function, "f") {
+		return
+	}
+	if len(call.Arguments) != 1 {
+		t.Fatalf("wrong length of arguments. got=%d", len(call.Arguments))
+	}
+	if !testIdentifier(t, call.Arguments[0], "x") {
+		return
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`x |> f |> g`, `g(f(x))`},
+		{`x |> f(y)`, `f(x, y)`},
+		{`x |> f(y) |> g(1, 2)`, `g(f(x, y), 1, 2)`},
+		{`a + b |> f`, `f((a + b))`},
+		{`[1, 2] |> len`, `len([1, 2])`},
+		{`x |> fn(n) { n * 2 }`, `fn(n) (n * 2)(x)`},
+		{`x |> f(y)[0]`, `(f(y)[0])(x)`},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	logTestResult(t, true, "TestPipeExpressionParsing")
+}
+
+func TestImmediatelyInvokedFunctionParsing(t *testing.T) {
+	input := `fn(x) { x * 2 }(21);`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	call, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+	function, ok := call.Function.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("call.Function is not ast.FunctionLiteral. got=%T", call.Function)
+	}
+	if len(function.Parameters) != 1 {
+		t.Fatalf("function literal has wrong parameters. got=%d", len(function.Parameters))
+	}
+	if len(call.Arguments) != 1 {
+		t.Fatalf("wrong length of arguments. got=%d", len(call.Arguments))
+	}
+	testIntegerLiteral(t, call.Arguments[0], 21)
+
+	logTestResult(t, true, "TestImmediatelyInvokedFunctionParsing")
+}
+
+func TestChainedCallAndIndexParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`f()[0]`, `(f()[0])`},
+		{`a[0][1]`, `((a[0])[1])`},
+		{`f(g(1))[h()]`, `(f(g(1))[h()])`},
+		{`hash["a"]["b"]`, `((hash[a])[b])`},
+		{`f()()`, `f()()`},
+		{`a[0](1)[2]`, `((a[0])(1)[2])`},
+		{`f()[0] * a[1][2]`, `((f()[0]) * ((a[1])[2]))`},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	// The outermost expression is the last index, applied to everything before it
+	l := lexer.New(`f(g(1))[h()]`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	index, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IndexExpression. got=%T", stmt.Expression)
+	}
+	if _, ok := index.Left.(*ast.CallExpression); !ok {
+		t.Fatalf("index.Left is not ast.CallExpression. got=%T", index.Left)
+	}
+	if _, ok := index.Index.(*ast.CallExpression); !ok {
+		t.Fatalf("index.Index is not ast.CallExpression. got=%T", index.Index)
+	}
+
+	logTestResult(t, true, "TestChainedCallAndIndexParsing")
+}
+
+func TestTemplateStringParsing(t *testing.T) {
+	input := `"Hello, ${name}! ${1 + 2 * 3}"`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	template, ok := stmt.Expression.(*ast.TemplateStringLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TemplateStringLiteral. got=%T", stmt.Expression)
+	}
+	if len(template.Parts) != 4 {
+		t.Fatalf("template has wrong number of parts. got=%d", len(template.Parts))
+	}
+	for i, expected := range []string{"Hello, ", "! "} {
+		text, ok := template.Parts[i*2].(*ast.StringLiteral)
+		if !ok || text.Value != expected {
+			t.Errorf("template.Parts[%d] is not the string literal %q. got=%T (%+v)", i*2, expected, template.Parts[i*2], template.Parts[i*2])
+		}
+	}
+	if !testIdentifier(t, template.Parts[1], "name") {
+		return
+	}
+	if template.Parts[3].String() != "(1 + (2 * 3))" {
+		t.Errorf("template.Parts[3] wrong. got=%q", template.Parts[3].String())
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`"${let x = 1;}"`, `interpolation must be a single expression, got "let x = 1;"`},
+		{`"${1; 2}"`, `interpolation must be a single expression, got "1; 2"`},
+		{`"${}"`, `interpolation must be a single expression, got ""`},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %s. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+
+	logTestResult(t, true, "TestTemplateStringParsing")
+}
+
+func TestArrowFunctionParsing(t *testing.T) {
+	input := `let double = (x) => x * 2;`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.LetStatement)
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+	if len(function.Parameters) != 1 {
+		t.Fatalf("function literal parameters wrong. want 1, got=%d", len(function.Parameters))
+	}
+	testLiteralExpression(t, function.Parameters[0], "x")
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statement. got=%d", len(function.Body.Statements))
+	}
+	ret, ok := function.Body.Statements[0].(*ast.ReturnStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ReturnStatement. got=%T", function.Body.Statements[0])
+	}
+	testInfixExpression(t, ret.ReturnValue, "x", "*", 2)
+
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expectedBody   string
+	}{
+		{`() => 1`, []string{}, "return 1;"},
+		{`(x) => x`, []string{"x"}, "return x;"},
+		{`(a, b) => a + b`, []string{"a", "b"}, "return (a + b);"},
+		{`(a, b, c) => f(a, b)(c)`, []string{"a", "b", "c"}, "return f(a, b)(c);"},
+		{`(x) => (y) => x + y`, []string{"x"}, "return fn(y) return (x + y);;"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		function, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("%s is not ast.FunctionLiteral", tt.input)
+		}
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+		if function.Body.String() != tt.expectedBody {
+			t.Errorf("body wrong for %s. expected=%q, got=%q", tt.input, tt.expectedBody, function.Body.String())
+		}
+	}
+
+	// Grouped expressions are unaffected
+	l = lexer.New(`(a + b) * c`)
+	p = New(l)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	if program.String() != "((a + b) * c)" {
+		t.Errorf("grouped expression wrong. got=%q", program.String())
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`(1) => 1`, "arrow function parameters must be identifiers, got 1"},
+		{`(a, b)`, "expected next token to be =>, got EOF"},
+		{`()`, "expected next token to be =>, got EOF"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %s. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+
+	logTestResult(t, true, "TestArrowFunctionParsing")
+}
+
+func TestDestructuringStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedNames []string
+		expected      string
+	}{
+		{`let [a, b] = [1, 2];`, []string{"a", "b"}, "let [a, b] = [1, 2];"},
+		{`let [_, b] = pair`, []string{"_", "b"}, "let [_, b] = pair;"},
+		{`let [x] = f();`, []string{"x"}, "let [x] = f();"},
+		{`let [] = []`, []string{}, "let [] = [];"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt, ok := program.Statements[0].(*ast.DestructuringStatement)
+		if !ok {
+			t.Fatalf("%s is not ast.DestructuringStatement. got=%T", tt.input, program.Statements[0])
+		}
+		if len(stmt.Names) != len(tt.expectedNames) {
+			t.Fatalf("length names wrong. want %d, got=%d", len(tt.expectedNames), len(stmt.Names))
+		}
+		for i, name := range tt.expectedNames {
+			testLiteralExpression(t, stmt.Names[i], name)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("statement wrong. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, 1] = b`, "expected next token to be IDENT, got INT"},
+		{`let [a b] = c`, "expected next token to be ,, got IDENT"},
+		{`let [a] c`, "expected next token to be =, got IDENT"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %s. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+
+	logTestResult(t, true, "TestDestructuringStatements")
+}
+
+func TestParserRecoversAfterBadStatement(t *testing.T) {
+	input := `let = 5; let x 5; let y = 1; y;`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	expected := []string{
+		"expected next token to be IDENT, got =",
+		"expected next token to be =, got INT",
+	}
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%q, got=%q", expected, errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, msg, errors[i])
+		}
+	}
+
+	// The statements after the bad ones are still parsed
+	if program.String() != "let y = 1;y" {
+		t.Errorf("program wrong. got=%q", program.String())
+	}
+
+	logTestResult(t, true, "TestParserRecoversAfterBadStatement")
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`arr[1] = 99`, "((arr[1]) = 99)"},
+		{`h["a"] = 1 + 2`, "((h[a]) = (1 + 2))"},
+		{`a[0] = b[0] = 5`, "((a[0]) = ((b[0]) = 5))"},
+		{`a[0] = x |> f`, "((a[0]) = f(x))"},
+		{`matrix[0][1] = 2`, "(((matrix[0])[1]) = 2)"},
+		{`x = 5`, "(x = 5)"},
+		{`a = b = 5`, "(a = (b = 5))"},
+		{`a = (b = 5)`, "(a = (b = 5))"},
+		{`a = b[0] = c = 1 + 2`, "(a = ((b[0]) = (c = (1 + 2))))"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.AssignExpression); !ok {
+			t.Fatalf("%s is not ast.AssignExpression. got=%T", tt.input, stmt.Expression)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`5 = 1`, "invalid assignment target: 5"},
+		{`f() = 1`, "invalid assignment target: f()"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %s. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+
+	logTestResult(t, true, "TestAssignExpressionParsing")
+}
+
+func TestIncrementExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedOperator string
+		expectedPrefix   bool
+		expected         string
+	}{
+		{`++i`, "++", true, "(++i)"},
+		{`--i`, "--", true, "(--i)"},
+		{`i++`, "++", false, "(i++)"},
+		{`i--`, "--", false, "(i--)"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.IncrementExpression)
+		if !ok {
+			t.Fatalf("%s is not ast.IncrementExpression. got=%T", tt.input, stmt.Expression)
+		}
+		if exp.Operator != tt.expectedOperator || exp.Prefix != tt.expectedPrefix {
+			t.Errorf("%s parsed wrong. operator=%q, prefix=%t", tt.input, exp.Operator, exp.Prefix)
+		}
+		testLiteralExpression(t, exp.Name, "i")
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	precedence := []struct {
+		input    string
+		expected string
+	}{
+		{`++i + 1`, "((++i) + 1)"},
+		{`i++ * 2`, "((i++) * 2)"},
+		{`-i++`, "(-(i++))"},
+		{`1 - --i`, "(1 - (--i))"},
+	}
+	for _, tt := range precedence {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`++5`, "++ can only be applied to a variable, got 5"},
+		{`--a[0]`, "-- can only be applied to a variable, got (a[0])"},
+		{`f()++`, "++ can only be applied to a variable, got f()"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %s. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+
+	logTestResult(t, true, "TestIncrementExpressionParsing")
+}
+
+func TestNegativeNumbersInLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[-1, -2]`, "[(-1), (-2)]"},
+		{`[-1]`, "[(-1)]"},
+		{`[1, -2.5, -x]`, "[1, (-2.5), (-x)]"},
+		{`[-1][0]`, "([(-1)][0])"},
+		{`arr[-1]`, "(arr[(-1)])"},
+		{`f(-1, -2)`, "f((-1), (-2))"},
+		{`f(1 - -2)`, "f((1 - (-2)))"},
+		{`{"a": -1}["a"]`, "({a:(-1)}[a])"},
+		{`{-2: "b"}`, "{(-2):b}"},
+		{`-1 * 2`, "((-1) * 2)"},
+		{`-f(1)`, "(-f(1))"},
+		{`-arr[0]`, "(-(arr[0]))"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	logTestResult(t, true, "TestNegativeNumbersInLiterals")
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+
+	logTestResult(t, true, "TestMacroLiteralParsing")
+}
+
 func logTestResult(t *testing.T, passed bool, testName string) {
 	if passed {
 		t.Logf(Green+"%s passed"+Reset, testName)
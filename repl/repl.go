@@ -4,11 +4,15 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 
+	"github.com/ajtroup1/clearv2/ast"
 	"github.com/ajtroup1/clearv2/evaluator"
 	"github.com/ajtroup1/clearv2/lexer"
 	"github.com/ajtroup1/clearv2/object"
 	"github.com/ajtroup1/clearv2/parser"
+	"github.com/ajtroup1/clearv2/token"
 )
 
 const MONKEY_FACE = `            __,__
@@ -26,36 +30,269 @@ const MONKEY_FACE = `            __,__
 
 const PROMPT = "Clear >> "
 
+// ANSI escape codes used to color REPL output
+const (
+	RED   = "\033[31m"
+	RESET = "\033[0m"
+)
+
+// Whether the REPL colors its error output
+// On unless the NO_COLOR environment variable is set (https://no-color.org), for terminals and logs that don't support color
+var UseColor = os.Getenv("NO_COLOR") == ""
+
+// Lines starting with this prefix are REPL meta-commands rather than Clear code: ":history"
+const META_PREFIX = ":"
+
+// Meta-commands understood by the REPL, with the description shown by ":help"
+var metaCommands = []struct {
+	name        string
+	description string
+}{
+	{":help", "List the meta-commands and builtin functions"},
+	{":debug", "Step through each statement, pressing enter to evaluate it (:debug on) or stop stepping (:debug off)"},
+	{":history", "Print the lines of code entered this session"},
+	{":save", "Write the lines of code entered this session to a file (:save session.clr)"},
+	{":types", "Show the type of each result (:types on) or stop showing it (:types off)"},
+	{":warnings", "Warn when a let shadows a builtin function (:warnings on) or stop warning (:warnings off)"},
+}
+
+// State of a REPL session that meta-commands can read and change
+type session struct {
+	history   []string // Every line of Clear code entered this session, oldest first
+	showTypes bool     // Whether results are printed along with their type: "=> 5 : INTEGER"
+	debug     bool     // Whether each statement waits for enter before it's evaluated
+}
+
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	s := &session{}
 	for {
-		fmt.Printf(PROMPT)
+		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
 		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if strings.HasPrefix(line, META_PREFIX) {
+			handleMetaCommand(out, line, s)
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			s.history = append(s.history, line)
+		}
+		if s.debug {
+			if !debugLine(scanner, out, line, env) {
+				return
+			}
+			continue
+		}
+		evaluated, errors := Run(line, env)
+		if len(errors) != 0 {
+			printParserErrors(out, errors)
+			continue
+		}
+		// Warnings don't stop evaluation, so they're printed ahead of the result
+		for _, warning := range evaluator.Warnings() {
+			io.WriteString(out, warning+"\n")
+		}
+		if err, ok := evaluated.(*object.Error); ok && err.Line > 0 {
+			io.WriteString(out, FormatError(line, err))
 			continue
 		}
-		evaluated := evaluator.Eval(program, env)
 		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+			if s.showTypes {
+				fmt.Fprintf(out, "=> %s : %s\n", evaluated.Inspect(), evaluated.Type())
+			} else {
+				io.WriteString(out, evaluated.Inspect())
+				io.WriteString(out, "\n")
+			}
 		}
 	}
 }
 
+// Evaluates a line one statement at a time, printing each statement and waiting for enter before evaluating it
+// Macros are expanded first, as Run does, so the statements stepped through are the expanded ones
+// Each statement's result is printed after it's evaluated. Stepping stops early at an error or a return
+// Returns false if the input ran out while waiting
+func debugLine(scanner *bufio.Scanner, out io.Writer, line string, env *object.Environment) bool {
+	p := parser.New(lexer.New(line))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return true
+	}
+	evaluator.DefineMacros(program, env)
+	expanded, err := evaluator.ExpandMacros(program, env)
+	if err != nil {
+		fmt.Fprintf(out, "=> %s\n", (&object.Error{Message: err.Error()}).Inspect())
+		return true
+	}
+	program = expanded.(*ast.Program)
+	for i, stmt := range program.Statements {
+		fmt.Fprintf(out, "[%d/%d] %s\n", i+1, len(program.Statements), stmt.String())
+		if !scanner.Scan() {
+			return false
+		}
+		evaluated := evaluator.Eval(stmt, env)
+		if evaluated == nil {
+			continue
+		}
+		if returned, ok := evaluated.(*object.ReturnValue); ok {
+			fmt.Fprintf(out, "=> %s\n", returned.Inspect())
+			break
+		}
+		fmt.Fprintf(out, "=> %s\n", evaluated.Inspect())
+		if evaluated.Type() == object.ERROR_OBJ {
+			break
+		}
+	}
+	return true
+}
+
+// Lexes, parses and evaluates the given source code against the environment, expanding any macros first
+// If the source doesn't parse, nothing is evaluated and the parser errors are returned instead
+// Shared by the REPL, which reports the errors and carries on, and file mode, which treats them as fatal
+// A runtime error only keeps its position if it's in this source, so FormatError can show it against the source
+// Errors from elsewhere, like a function defined on an earlier REPL line or code run by eval, lose their position
+func Run(source string, env *object.Environment) (object.Object, []string) {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, p.Errors()
+	}
+	evaluator.DefineMacros(program, env)
+	expanded, err := evaluator.ExpandMacros(program, env)
+	if err != nil {
+		return &object.Error{Message: err.Error()}, nil
+	}
+	evaluated := evaluator.Eval(expanded, env)
+	if err, ok := evaluated.(*object.Error); ok && err.Source != l.Source() {
+		return &object.Error{Message: err.Message}, nil
+	}
+	return evaluated, nil
+}
+
+// Formats a runtime error along with the line of source it occurred on and a caret under its column
+// EX. for "1 + true":
+//
+//	ERROR: type mismatch: INTEGER + BOOLEAN
+//	  1 + true
+//	    ^
+func FormatError(source string, err *object.Error) string {
+	lines := strings.Split(source, "\n")
+	if err.Line < 1 || err.Line > len(lines) {
+		return err.Inspect() + "\n"
+	}
+	sourceLine := strings.TrimRight(lines[err.Line-1], "\r")
+	// The caret is indented with the line's own tabs, so it stays aligned however tabs are displayed
+	var indent strings.Builder
+	for i := 0; i < err.Column-1 && i < len(sourceLine); i++ {
+		if sourceLine[i] == '\t' {
+			indent.WriteByte('\t')
+		} else {
+			indent.WriteByte(' ')
+		}
+	}
+	return fmt.Sprintf("%s\n  %s\n  %s^\n", err.Inspect(), sourceLine, indent.String())
+}
+
+// Writes the token stream of the given source code to out, one token per line, without parsing it
+func DumpTokens(out io.Writer, source string) {
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(out, "%-10s %q\n", tok.Type, tok.Literal)
+	}
+}
+
+// Writes the parsed program of the given source code to out, without evaluating it
+// If the source doesn't parse, nothing is written and the parser errors are returned instead
+func DumpAST(out io.Writer, source string) []string {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return p.Errors()
+	}
+	for _, stmt := range program.Statements {
+		fmt.Fprintln(out, stmt.String())
+	}
+	return nil
+}
+
+// Runs a REPL meta-command such as ":history", followed by any arguments: ":types on"
+func handleMetaCommand(out io.Writer, command string, s *session) {
+	fields := strings.Fields(command) // Never empty, since the command starts with META_PREFIX
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case ":help":
+		printHelp(out)
+	case ":debug":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			io.WriteString(out, "usage: :debug on|off\n")
+			return
+		}
+		s.debug = args[0] == "on"
+	case ":history":
+		for i, line := range s.history {
+			fmt.Fprintf(out, "%d: %s\n", i+1, line)
+		}
+	case ":save":
+		if len(args) != 1 {
+			io.WriteString(out, "usage: :save path\n")
+			return
+		}
+		contents := ""
+		for _, line := range s.history {
+			contents += line + "\n"
+		}
+		if err := os.WriteFile(args[0], []byte(contents), 0644); err != nil {
+			fmt.Fprintf(out, "could not save session: %s\n", err)
+			return
+		}
+		fmt.Fprintf(out, "saved %d lines to %s\n", len(s.history), args[0])
+	case ":types":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			io.WriteString(out, "usage: :types on|off\n")
+			return
+		}
+		s.showTypes = args[0] == "on"
+	case ":warnings":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			io.WriteString(out, "usage: :warnings on|off\n")
+			return
+		}
+		evaluator.WarnShadowing = args[0] == "on"
+	default:
+		fmt.Fprintf(out, "unknown command: %s\n", command)
+	}
+}
+
+// Writes the meta-commands and the names of the builtin functions to out
+func printHelp(out io.Writer) {
+	io.WriteString(out, "Commands:\n")
+	for _, command := range metaCommands {
+		fmt.Fprintf(out, "  %-10s %s\n", command.name, command.description)
+	}
+	io.WriteString(out, "Builtins:\n")
+	fmt.Fprintf(out, "  %s\n", strings.Join(evaluator.BuiltinNames(), ", "))
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
 	io.WriteString(out, " parser errors:\n")
 	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+		io.WriteString(out, "\t"+colored(msg, RED)+"\n")
+	}
+}
+
+// Wraps the text in the given color's escape codes, or returns it unchanged when UseColor is off
+func colored(text string, color string) string {
+	if !UseColor {
+		return text
 	}
+	return color + text + RESET
 }
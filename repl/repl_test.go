@@ -0,0 +1,389 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ajtroup1/clearv2/evaluator"
+	"github.com/ajtroup1/clearv2/object"
+)
+
+func TestHistoryCommand(t *testing.T) {
+	input := "let a = 1;\n\na + 1\n:history\n"
+	var out bytes.Buffer
+
+	Start(strings.NewReader(input), &out)
+
+	expected := "1: let a = 1;\n2: a + 1\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("history output wrong. expected to contain %q, got=%q",
+			expected, out.String())
+	}
+	if strings.Contains(out.String(), "3: ") {
+		t.Errorf("history should not include blank lines or meta-commands. got=%q",
+			out.String())
+	}
+}
+
+func TestUnknownMetaCommand(t *testing.T) {
+	var out bytes.Buffer
+
+	Start(strings.NewReader(":nope\n"), &out)
+
+	if !strings.Contains(out.String(), "unknown command: :nope") {
+		t.Errorf("expected unknown command message. got=%q", out.String())
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	var out bytes.Buffer
+
+	Start(strings.NewReader(":help\n"), &out)
+
+	expected := []string{
+		"  :help      List the meta-commands and builtin functions\n",
+		"  :history   Print the lines of code entered this session\n",
+		"Builtins:\n",
+		"len",
+		"readFile",
+		"upper",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("help output wrong. expected to contain %q, got=%q", e, out.String())
+		}
+	}
+}
+
+func TestTypesCommand(t *testing.T) {
+	var out bytes.Buffer
+
+	Start(strings.NewReader("1 + 1\n:types on\n2 + 3\n\"hi\"\n:types off\n4\n"), &out)
+
+	expected := PROMPT + "2\n" +
+		PROMPT +
+		PROMPT + "=> 5 : INTEGER\n" +
+		PROMPT + "=> hi : STRING\n" +
+		PROMPT +
+		PROMPT + "4\n" +
+		PROMPT
+	if out.String() != expected {
+		t.Errorf("types output wrong. expected=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":types maybe\n"), &out)
+	if !strings.Contains(out.String(), "usage: :types on|off") {
+		t.Errorf("expected usage message. got=%q", out.String())
+	}
+}
+
+func TestWarningsCommand(t *testing.T) {
+	original := evaluator.WarnShadowing
+	defer func() { evaluator.WarnShadowing = original }()
+	var out bytes.Buffer
+
+	Start(strings.NewReader("let len = 1;\n:warnings on\nlet len = 2; len\nlet x = 3;\n:warnings off\nlet len = 4;\n"), &out)
+
+	expected := PROMPT +
+		PROMPT +
+		PROMPT + "warning: len shadows a builtin function\n2\n" +
+		PROMPT +
+		PROMPT +
+		PROMPT +
+		PROMPT
+	if out.String() != expected {
+		t.Errorf("warnings output wrong. expected=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":warnings maybe\n"), &out)
+	if !strings.Contains(out.String(), "usage: :warnings on|off") {
+		t.Errorf("expected usage message. got=%q", out.String())
+	}
+}
+
+func TestParserErrorColor(t *testing.T) {
+	original := UseColor
+	defer func() { UseColor = original }()
+
+	var out bytes.Buffer
+	UseColor = true
+	Start(strings.NewReader("let = 5;\n"), &out)
+	if !strings.Contains(out.String(), "\t"+RED+"expected next token to be IDENT, got ="+RESET+"\n") {
+		t.Errorf("expected colored parser error. got=%q", out.String())
+	}
+
+	out.Reset()
+	UseColor = false
+	Start(strings.NewReader("let = 5;\n"), &out)
+	if !strings.Contains(out.String(), "\texpected next token to be IDENT, got =\n") {
+		t.Errorf("expected plain parser error. got=%q", out.String())
+	}
+	if strings.Contains(out.String(), "\033[") {
+		t.Errorf("output contains escape codes with color disabled. got=%q", out.String())
+	}
+}
+
+func TestSaveCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.clr")
+	var out bytes.Buffer
+
+	Start(strings.NewReader("let a = 1;\n:history\na + 1\n:save "+path+"\n"), &out)
+
+	if !strings.Contains(out.String(), "saved 2 lines to "+path) {
+		t.Errorf("expected save confirmation. got=%q", out.String())
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("saved file could not be read: %s", err)
+	}
+	expected := "let a = 1;\na + 1\n"
+	if string(contents) != expected {
+		t.Errorf("saved file wrong. expected=%q, got=%q", expected, string(contents))
+	}
+}
+
+func TestSaveCommandErrors(t *testing.T) {
+	var out bytes.Buffer
+	missing := filepath.Join(t.TempDir(), "missing", "session.clr")
+
+	Start(strings.NewReader(":save\n:save "+missing+"\n"), &out)
+
+	if !strings.Contains(out.String(), "usage: :save path") {
+		t.Errorf("expected usage message. got=%q", out.String())
+	}
+	if !strings.Contains(out.String(), "could not save session: ") {
+		t.Errorf("expected file error. got=%q", out.String())
+	}
+}
+
+func TestRuntimeErrorShowsCaret(t *testing.T) {
+	var out bytes.Buffer
+
+	Start(strings.NewReader("let x = 5;\nx *  2 + true\n"), &out)
+
+	expected := PROMPT + PROMPT +
+		"ERROR: type mismatch: INTEGER + BOOLEAN\n" +
+		"  x *  2 + true\n" +
+		"         ^\n" +
+		PROMPT
+	if out.String() != expected {
+		t.Errorf("output wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	tests := []struct {
+		source   string
+		err      *object.Error
+		expected string
+	}{
+		{"a\n\tb + c", &object.Error{Message: "boom", Line: 2, Column: 4}, "ERROR: boom\n  \tb + c\n  \t  ^\n"},
+		{"1 + 2", &object.Error{Message: "boom"}, "ERROR: boom\n"},
+		{"1 + 2", &object.Error{Message: "boom", Line: 3, Column: 1}, "ERROR: boom\n"},
+	}
+	for _, tt := range tests {
+		got := FormatError(tt.source, tt.err)
+		if got != tt.expected {
+			t.Errorf("FormatError(%q) wrong. expected=%q, got=%q", tt.source, tt.expected, got)
+		}
+	}
+}
+
+func TestDebugCommand(t *testing.T) {
+	var out bytes.Buffer
+
+	input := ":debug on\nlet x = 5; x * 2\n\n\n:debug off\nx\n"
+	Start(strings.NewReader(input), &out)
+
+	expected := PROMPT +
+		PROMPT + "[1/2] let x = 5;\n" +
+		"[2/2] (x * 2)\n" +
+		"=> 10\n" +
+		PROMPT +
+		PROMPT + "5\n" +
+		PROMPT
+	if out.String() != expected {
+		t.Errorf("output wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestDebugCommandStopsAtErrors(t *testing.T) {
+	var out bytes.Buffer
+
+	Start(strings.NewReader(":debug on\n1 + true; 2\n\n"), &out)
+
+	expected := PROMPT +
+		PROMPT + "[1/2] (1 + true)\n" +
+		"=> ERROR: type mismatch: INTEGER + BOOLEAN\n" +
+		PROMPT
+	if out.String() != expected {
+		t.Errorf("output wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":debug maybe\n"), &out)
+	if !strings.Contains(out.String(), "usage: :debug on|off") {
+		t.Errorf("expected usage message. got=%q", out.String())
+	}
+}
+
+func TestDebugCommandResolvesReturnedCalls(t *testing.T) {
+	var out bytes.Buffer
+
+	Start(strings.NewReader(":debug on\nlet f = fn(x) { x * 2 }; return f(4); 5\n\n\n"), &out)
+
+	expected := PROMPT +
+		PROMPT + "[1/3] let f = fn(x) (x * 2);\n" +
+		"[2/3] return f(4);\n" +
+		"=> 8\n" +
+		PROMPT
+	if out.String() != expected {
+		t.Errorf("output wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestDebugCommandStepBudget(t *testing.T) {
+	original := evaluator.MaxSteps
+	defer func() { evaluator.MaxSteps = original }()
+	evaluator.MaxSteps = 20
+
+	// Each statement is evaluated on its own, so the budget doesn't run out over a long debugging session
+	var out bytes.Buffer
+	Start(strings.NewReader(":debug on\n"+strings.Repeat("1 + 2 * 3\n\n", 30)), &out)
+	if strings.Contains(out.String(), "evaluation limit exceeded") {
+		t.Errorf("step budget carried over between statements. got=%q", out.String())
+	}
+}
+
+func TestRunExpandsMacros(t *testing.T) {
+	env := object.NewEnvironment()
+	Run("let unless = macro(cond, body) { quote(if (!(unquote(cond))) { unquote(body); }); };", env)
+
+	evaluated, errors := Run("unless(1 > 2, 10)", env)
+	if len(errors) != 0 {
+		t.Fatalf("unexpected parser errors: %v", errors)
+	}
+	if evaluated == nil || evaluated.Inspect() != "10" {
+		t.Errorf("macro call wrong. expected=10, got=%v", evaluated)
+	}
+
+	evaluated, _ = Run("let m = macro() { 1 }; m()", env)
+	if evaluated == nil || evaluated.Inspect() != "ERROR: macro must return QUOTE, got INTEGER" {
+		t.Errorf("bad macro error wrong. got=%v", evaluated)
+	}
+}
+
+func TestDebugCommandExpandsMacros(t *testing.T) {
+	var out bytes.Buffer
+
+	input := ":debug on\nlet unless = macro(cond, body) { quote(if (!(unquote(cond))) { unquote(body); }); }; unless(1 > 2, 10)\n\n"
+	Start(strings.NewReader(input), &out)
+
+	expected := PROMPT +
+		PROMPT + "[1/1] if(!(1 > 2)) 10\n" +
+		"=> 10\n" +
+		PROMPT
+	if out.String() != expected {
+		t.Errorf("output wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestRunReturnsParseErrors(t *testing.T) {
+	evaluated, errors := Run("let = 5; let x 5;", object.NewEnvironment())
+
+	if evaluated != nil {
+		t.Errorf("malformed source should not be evaluated. got=%s", evaluated.Inspect())
+	}
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors for malformed source")
+	}
+	expected := "expected next token to be IDENT, got ="
+	if errors[0] != expected {
+		t.Errorf("wrong first error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestRunEvaluatesValidSource(t *testing.T) {
+	env := object.NewEnvironment()
+	evaluated, errors := Run("let x = 5; x * 2", env)
+
+	if len(errors) != 0 {
+		t.Fatalf("unexpected parser errors: %v", errors)
+	}
+	if evaluated == nil || evaluated.Inspect() != "10" {
+		t.Errorf("wrong result. expected=10, got=%v", evaluated)
+	}
+	if _, ok := env.Get("x"); !ok {
+		t.Errorf("bindings should persist in the given environment")
+	}
+}
+
+func TestRunDropsPositionsFromOtherSources(t *testing.T) {
+	env := object.NewEnvironment()
+	Run("let f = fn(x) { x + true };", env)
+
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"f(1)", 0, 0},
+		{"let x = 1;\neval(\"1 + true\")", 0, 0},
+		{"let x = 1;\nx + true", 2, 3},
+	}
+	for _, tt := range tests {
+		evaluated, _ := Run(tt.input, env)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("%q: expected an error, got=%v", tt.input, evaluated)
+		}
+		if err.Line != tt.expectedLine || err.Column != tt.expectedColumn {
+			t.Errorf("%q: wrong position. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedLine, tt.expectedColumn, err.Line, err.Column)
+		}
+	}
+}
+
+func TestDumpTokens(t *testing.T) {
+	var out bytes.Buffer
+
+	DumpTokens(&out, `let x = "hi";`)
+
+	expected := `LET        "let"
+IDENT      "x"
+=          "="
+STRING     "hi"
+;          ";"
+`
+	if out.String() != expected {
+		t.Errorf("wrong token dump. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestDumpAST(t *testing.T) {
+	var out bytes.Buffer
+
+	errors := DumpAST(&out, "let x = 1 + 2 * 3; x;")
+
+	if len(errors) != 0 {
+		t.Fatalf("unexpected parser errors: %v", errors)
+	}
+	expected := "let x = (1 + (2 * 3));\nx\n"
+	if out.String() != expected {
+		t.Errorf("wrong AST dump. expected=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	errors = DumpAST(&out, "let = 1;")
+	if len(errors) == 0 {
+		t.Errorf("expected parser errors for malformed source")
+	}
+	if out.Len() != 0 {
+		t.Errorf("nothing should be dumped for malformed source. got=%q", out.String())
+	}
+}
@@ -6,9 +6,13 @@ type TokenType string
 
 // Represents a single token object in the Clear programming language
 // Tokens have a type (keyword, operator, ...) and a literal value associated with it (+, 5, x, ...)
+// Tokens produced by the lexer also record where they start in the source, for error messages. Both are 1-based, and 0 when unknown
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // Line the token starts on
+	Column  int // Column the token starts at, counted in bytes
+	Source  int // Identifies the source the token was lexed from, since its line & column only make sense within it
 }
 
 // Constants for various token types used in the Clear language
@@ -17,8 +21,11 @@ const (
 	EOF     = "EOF"     // End of file
 
 	// Identifiers and literals
-	IDENT = "IDENT" // General identifier (e.g., variable names, function names)
-	INT   = "INT"   // Integer literal (e.g., 12345)
+	IDENT    = "IDENT"    // General identifier (e.g., variable names, function names)
+	INT      = "INT"      // Integer literal (e.g., 12345)
+	FLOAT    = "FLOAT"    // Floating point literal (e.g., 1.5)
+	STRING   = "STRING"   // String literal (e.g., "hello")
+	TEMPLATE = "TEMPLATE" // String literal with interpolations (e.g., "Hello, ${name}!"), split up by the parser
 
 	// Operators
 	ASSIGN   = "="  // Assignment operator
@@ -29,16 +36,27 @@ const (
 	BANG     = "!"  // Logical negation (not) operator
 	ASTERISK = "*"  // Multiplication operator
 	SLASH    = "/"  // Division operator
+	FLOORDIV = "//" // Floor division operator. Clear has no line comments, so "//" is free to be an operator
 	LT       = "<"  // Less-than operator
 	GT       = ">"  // Greater-than operator
+	LT_EQ    = "<=" // Less-than-or-equal operator
+	GT_EQ    = ">=" // Greater-than-or-equal operator
+	INC      = "++" // Increment operator, prefix (++i) or postfix (i++)
+	DEC      = "--" // Decrement operator, prefix (--i) or postfix (i--)
+	PIPE     = "|>" // Pipe operator, passes its left side as the first argument of the call on its right
 
 	// Delimiters
-	COMMA     = "," // Comma separator
-	SEMICOLON = ";" // Semicolon separator
-	LPAREN    = "(" // Left parenthesis
-	RPAREN    = ")" // Right parenthesis
-	LBRACE    = "{" // Left brace (beginning of a block)
-	RBRACE    = "}" // Right brace (end of a block)
+	COMMA     = ","  // Comma separator
+	SEMICOLON = ";"  // Semicolon separator
+	COLON     = ":"  // Colon separator (between hash keys and values)
+	DOT       = "."  // Dot (method calls: "hello".len())
+	LPAREN    = "("  // Left parenthesis
+	RPAREN    = ")"  // Right parenthesis
+	LBRACE    = "{"  // Left brace (beginning of a block)
+	RBRACE    = "}"  // Right brace (end of a block)
+	LBRACKET  = "["  // Left bracket (beginning of an array or index)
+	RBRACKET  = "]"  // Right bracket (end of an array or index)
+	ARROW     = "=>" // Arrow between an arrow function's parameters and its body: (x) => x * 2
 
 	// Keywords
 	FUNCTION = "FUNCTION" // Function keyword (e.g., function definitions)
@@ -48,6 +66,7 @@ const (
 	IF       = "IF"       // If keyword (conditional statements)
 	ELSE     = "ELSE"     // Else keyword (alternative conditional branches)
 	RETURN   = "RETURN"   // Return keyword (function return statements)
+	MACRO    = "MACRO"    // Macro keyword (macro definitions)
 )
 
 // Keyword map for reserved words in Clear
@@ -59,6 +78,7 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"macro":  MACRO,
 }
 
 // Check for if the given identifier exists as a reserved word in Clear
@@ -70,3 +90,72 @@ func LookupIdent(ident string) TokenType {
 	// If not, it must just be an identifier
 	return IDENT
 }
+
+// Category sets used to classify token types, e.g. for syntax highlighting
+// New token types should be added to the matching set when they're introduced
+var operators = map[TokenType]bool{
+	ASSIGN:   true,
+	EQ:       true,
+	NOT_EQ:   true,
+	PLUS:     true,
+	MINUS:    true,
+	BANG:     true,
+	ASTERISK: true,
+	SLASH:    true,
+	FLOORDIV: true,
+	LT:       true,
+	GT:       true,
+	LT_EQ:    true,
+	GT_EQ:    true,
+	INC:      true,
+	DEC:      true,
+	PIPE:     true,
+}
+
+var literals = map[TokenType]bool{
+	INT:      true,
+	FLOAT:    true,
+	STRING:   true,
+	TEMPLATE: true,
+}
+
+// Reports whether the token type is an operator: "+", "==", "!"...
+func IsOperator(t TokenType) bool {
+	return operators[t]
+}
+
+// Reports whether the token type is a reserved word: "let", "fn", "true"...
+func IsKeyword(t TokenType) bool {
+	for _, keyword := range keywords {
+		if keyword == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the token type is a literal value: "5", "1.5", "hello"...
+// Booleans are keywords rather than literals, since they're spelled as reserved words
+func IsLiteral(t TokenType) bool {
+	return literals[t]
+}
+
+// Display strings for token types whose type name differs from how they're written
+// Built from the keyword map, so keywords show as they're spelled ("FUNCTION" is "fn")
+// Operators & delimiters don't need entries since their types are already their symbols ("(", "==")
+var displayNames = func() map[TokenType]string {
+	names := make(map[TokenType]string, len(keywords))
+	for word, tokenType := range keywords {
+		names[tokenType] = word
+	}
+	return names
+}()
+
+// Returns a human-friendly name for the token type, for error messages & pretty-printing
+// EX. LPAREN is "(", FUNCTION is "fn", while literals & identifiers fall back to their raw type: "INT", "IDENT"
+func String(t TokenType) string {
+	if name, ok := displayNames[t]; ok {
+		return name
+	}
+	return string(t)
+}
@@ -0,0 +1,68 @@
+package token
+
+import "testing"
+
+func TestTokenCategories(t *testing.T) {
+	tests := []struct {
+		tokenType TokenType
+		operator  bool
+		keyword   bool
+		literal   bool
+	}{
+		{PLUS, true, false, false},
+		{EQ, true, false, false},
+		{BANG, true, false, false},
+		{ASSIGN, true, false, false},
+		{PIPE, true, false, false},
+		{LET, false, true, false},
+		{FUNCTION, false, true, false},
+		{TRUE, false, true, false},
+		{RETURN, false, true, false},
+		{MACRO, false, true, false},
+		{INT, false, false, true},
+		{FLOAT, false, false, true},
+		{STRING, false, false, true},
+		{IDENT, false, false, false},
+		{LPAREN, false, false, false},
+		{SEMICOLON, false, false, false},
+		{EOF, false, false, false},
+	}
+
+	for _, tt := range tests {
+		if IsOperator(tt.tokenType) != tt.operator {
+			t.Errorf("IsOperator(%s) wrong. expected=%t", tt.tokenType, tt.operator)
+		}
+		if IsKeyword(tt.tokenType) != tt.keyword {
+			t.Errorf("IsKeyword(%s) wrong. expected=%t", tt.tokenType, tt.keyword)
+		}
+		if IsLiteral(tt.tokenType) != tt.literal {
+			t.Errorf("IsLiteral(%s) wrong. expected=%t", tt.tokenType, tt.literal)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		tokenType TokenType
+		expected  string
+	}{
+		{LPAREN, "("},
+		{RBRACE, "}"},
+		{EQ, "=="},
+		{NOT_EQ, "!="},
+		{SEMICOLON, ";"},
+		{FUNCTION, "fn"},
+		{LET, "let"},
+		{TRUE, "true"},
+		{RETURN, "return"},
+		{INT, "INT"},
+		{IDENT, "IDENT"},
+		{EOF, "EOF"},
+	}
+
+	for _, tt := range tests {
+		if actual := String(tt.tokenType); actual != tt.expected {
+			t.Errorf("String(%s) wrong. expected=%q, got=%q", tt.tokenType, tt.expected, actual)
+		}
+	}
+}
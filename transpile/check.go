@@ -0,0 +1,391 @@
+package transpile
+
+import (
+	"fmt"
+	gotoken "go/token"
+	"strings"
+
+	"github.com/ajtroup1/clearv2/ast"
+)
+
+// The Go type of a Clear value: int64, bool, or a function type built from them
+// Types that aren't known yet start out unnamed and are filled in as they're unified with known ones,
+// so "fn(x) { x + 1 }" learns that x is an int64 from the addition
+type goType struct {
+	name   string    // "int64", "bool" or "func", or empty while the type isn't known
+	params []*goType // Parameter types of a func type
+	result *goType   // Result type of a func type
+	actual *goType   // The type an unknown type was unified with
+}
+
+func newUnknown() *goType { return &goType{} }
+
+var (
+	intType  = &goType{name: "int64"}
+	boolType = &goType{name: "bool"}
+)
+
+// Follows unified unknown types to the type they stand for
+func (t *goType) resolve() *goType {
+	for t.actual != nil {
+		t = t.actual
+	}
+	return t
+}
+
+// Returns the Go spelling of the type: "func(int64, bool) int64"
+// Returns false if any part of it is still unknown
+func (t *goType) goString() (string, bool) {
+	t = t.resolve()
+	switch t.name {
+	case "":
+		return "", false
+	case "func":
+		params := []string{}
+		for _, p := range t.params {
+			param, ok := p.goString()
+			if !ok {
+				return "", false
+			}
+			params = append(params, param)
+		}
+		result, ok := t.result.goString()
+		if !ok {
+			return "", false
+		}
+		return "func(" + strings.Join(params, ", ") + ") " + result, true
+	default:
+		return t.name, true
+	}
+}
+
+// Describes the type for error messages, showing unknown parts as "?"
+func (t *goType) String() string {
+	t = t.resolve()
+	switch t.name {
+	case "":
+		return "?"
+	case "func":
+		params := []string{}
+		for _, p := range t.params {
+			params = append(params, p.String())
+		}
+		return "func(" + strings.Join(params, ", ") + ") " + t.result.String()
+	default:
+		return t.name
+	}
+}
+
+// Makes two types the same, filling in unknown parts of either from the other
+// Returns false if they can't be the same type: "int64" and "bool"
+func unify(a, b *goType) bool {
+	a, b = a.resolve(), b.resolve()
+	switch {
+	case a == b:
+		return true
+	case a.name == "":
+		if occursIn(a, b) {
+			return false
+		}
+		a.actual = b
+		return true
+	case b.name == "":
+		return unify(b, a)
+	case a.name != b.name || len(a.params) != len(b.params):
+		return false
+	}
+	for i := range a.params {
+		if !unify(a.params[i], b.params[i]) {
+			return false
+		}
+	}
+	if a.name == "func" {
+		return unify(a.result, b.result)
+	}
+	return true
+}
+
+// Reports whether the unknown type appears within t, which would make unifying them an infinitely nested type
+func occursIn(unknown, t *goType) bool {
+	t = t.resolve()
+	if t == unknown {
+		return true
+	}
+	for _, p := range t.params {
+		if occursIn(unknown, p) {
+			return true
+		}
+	}
+	return t.result != nil && occursIn(unknown, t.result)
+}
+
+// A name bound by a let statement or a function parameter
+type binding struct {
+	typ  *goType
+	used bool // Go rejects local variables that are never used, so unused lets are emitted differently
+}
+
+// Names visible in a Go block, mirroring Go's scoping: each function and if branch gets its own
+type scope struct {
+	names map[string]*binding
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{names: map[string]*binding{}, outer: outer}
+}
+
+func (s *scope) lookup(name string) (*binding, bool) {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.names[name]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// Infers the Go type of every let, parameter and function result before any Go is emitted
+// Inference runs over the whole program first, since a parameter's type can be decided by code after the function
+type checker struct {
+	lets    map[*ast.LetStatement]*binding
+	params  map[*ast.FunctionLiteral][]*goType
+	results map[*ast.FunctionLiteral]*goType
+}
+
+func newChecker() *checker {
+	return &checker{
+		lets:    map[*ast.LetStatement]*binding{},
+		params:  map[*ast.FunctionLiteral][]*goType{},
+		results: map[*ast.FunctionLiteral]*goType{},
+	}
+}
+
+// Checks the program's top-level statements, which are emitted into a function with no result
+func (c *checker) program(program *ast.Program) error {
+	s := newScope(nil)
+	for _, stmt := range program.Statements {
+		if err := c.statement(stmt, s, nil, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks a statement. result is the enclosing function's result type, or nil at the top level
+// A statement in tail position gives the function's result, since Clear returns the last expression implicitly
+func (c *checker) statement(stmt ast.Statement, s *scope, result *goType, tail bool) error {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if tail {
+			return fmt.Errorf("transpile: function must end in an expression or return, got let %s", stmt.Name.Value)
+		}
+		return c.let(stmt, s, result)
+
+	case *ast.ReturnStatement:
+		if result == nil {
+			return fmt.Errorf("transpile: return outside a function is unsupported")
+		}
+		value, err := c.expression(stmt.ReturnValue, s, result)
+		if err != nil {
+			return err
+		}
+		if !unify(result, value) {
+			return fmt.Errorf("transpile: type mismatch: function returns %s and %s", result, value)
+		}
+
+	case *ast.ExpressionStatement:
+		if ifExp, ok := stmt.Expression.(*ast.IfExpression); ok {
+			return c.ifStatement(ifExp, s, result, tail)
+		}
+		value, err := c.expression(stmt.Expression, s, result)
+		if err != nil {
+			return err
+		}
+		if tail && !unify(result, value) {
+			return fmt.Errorf("transpile: type mismatch: function returns %s and %s", result, value)
+		}
+
+	default:
+		return fmt.Errorf("transpile: unsupported statement %T", stmt)
+	}
+	return nil
+}
+
+// Checks a let statement, binding its name in the current scope
+// A function is bound before its body is checked, so it can call itself
+func (c *checker) let(stmt *ast.LetStatement, s *scope, result *goType) error {
+	name := stmt.Name.Value
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if _, ok := s.names[name]; ok {
+		return fmt.Errorf("transpile: %s is already declared in this scope", name)
+	}
+	b := &binding{typ: newUnknown()}
+	c.lets[stmt] = b
+	if _, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		s.names[name] = b
+	}
+	value, err := c.expression(stmt.Value, s, result)
+	if err != nil {
+		return err
+	}
+	if !unify(b.typ, value) {
+		return fmt.Errorf("transpile: type mismatch: %s is %s and %s", name, b.typ, value)
+	}
+	s.names[name] = b
+	return nil
+}
+
+// Checks an if expression used as a statement. Each branch is its own scope, as in Go
+func (c *checker) ifStatement(ie *ast.IfExpression, s *scope, result *goType, tail bool) error {
+	if tail && ie.Alternative == nil {
+		return fmt.Errorf("transpile: if without else can't be used as a function's result")
+	}
+	condition, err := c.expression(ie.Condition, s, result)
+	if err != nil {
+		return err
+	}
+	if !unify(condition, boolType) {
+		return fmt.Errorf("transpile: if condition must be bool, got %s", condition)
+	}
+	if err := c.block(ie.Consequence, newScope(s), result, tail); err != nil {
+		return err
+	}
+	if ie.Alternative != nil {
+		return c.block(ie.Alternative, newScope(s), result, tail)
+	}
+	return nil
+}
+
+// Checks the statements of a block. When the block is in tail position, so is its last statement
+func (c *checker) block(block *ast.BlockStatement, s *scope, result *goType, tail bool) error {
+	if tail && len(block.Statements) == 0 {
+		return fmt.Errorf("transpile: function must end in an expression or return, got an empty block")
+	}
+	for i, stmt := range block.Statements {
+		if err := c.statement(stmt, s, result, tail && i == len(block.Statements)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the type of an expression
+func (c *checker) expression(exp ast.Expression, s *scope, result *goType) (*goType, error) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return intType, nil
+
+	case *ast.Boolean:
+		return boolType, nil
+
+	case *ast.Identifier:
+		b, ok := s.lookup(exp.Value)
+		if !ok {
+			return nil, fmt.Errorf("transpile: undefined identifier %s", exp.Value)
+		}
+		b.used = true
+		return b.typ, nil
+
+	case *ast.PrefixExpression:
+		right, err := c.expression(exp.Right, s, result)
+		if err != nil {
+			return nil, err
+		}
+		operand := intType
+		if exp.Operator == "!" {
+			operand = boolType
+		}
+		if !unify(right, operand) {
+			return nil, fmt.Errorf("transpile: type mismatch: %s%s", exp.Operator, right)
+		}
+		return operand, nil
+
+	case *ast.InfixExpression:
+		left, err := c.expression(exp.Left, s, result)
+		if err != nil {
+			return nil, err
+		}
+		right, err := c.expression(exp.Right, s, result)
+		if err != nil {
+			return nil, err
+		}
+		mismatch := fmt.Errorf("transpile: type mismatch: %s %s %s", left, exp.Operator, right)
+		switch exp.Operator {
+		case "+", "-", "*", "/":
+			if !unify(left, intType) || !unify(right, intType) {
+				return nil, mismatch
+			}
+			return intType, nil
+		case "<", ">":
+			if !unify(left, intType) || !unify(right, intType) {
+				return nil, mismatch
+			}
+			return boolType, nil
+		case "==", "!=":
+			if !unify(left, right) {
+				return nil, mismatch
+			}
+			// Go can't compare functions, so equality is limited to integers & booleans
+			if name := left.resolve().name; name != "int64" && name != "bool" {
+				return nil, fmt.Errorf("transpile: %s can only compare int64 or bool, got %s", exp.Operator, left)
+			}
+			return boolType, nil
+		default:
+			return nil, fmt.Errorf("transpile: unsupported operator %s", exp.Operator)
+		}
+
+	case *ast.CallExpression:
+		function, err := c.expression(exp.Function, s, result)
+		if err != nil {
+			return nil, err
+		}
+		call := &goType{name: "func", result: newUnknown()}
+		for _, a := range exp.Arguments {
+			arg, err := c.expression(a, s, result)
+			if err != nil {
+				return nil, err
+			}
+			call.params = append(call.params, arg)
+		}
+		if !unify(function, call) {
+			return nil, fmt.Errorf("transpile: type mismatch: %s called as %s", function, call)
+		}
+		return call.result, nil
+
+	case *ast.FunctionLiteral:
+		return c.functionLiteral(exp, s)
+
+	default:
+		return nil, fmt.Errorf("transpile: unsupported expression %T", exp)
+	}
+}
+
+// Returns the type of a function literal, inferring its parameter & result types from its body
+func (c *checker) functionLiteral(fl *ast.FunctionLiteral, s *scope) (*goType, error) {
+	body := newScope(s)
+	fn := &goType{name: "func", result: newUnknown()}
+	for _, p := range fl.Parameters {
+		if err := checkName(p.Value); err != nil {
+			return nil, err
+		}
+		param := newUnknown()
+		body.names[p.Value] = &binding{typ: param, used: true} // Go allows unused parameters
+		fn.params = append(fn.params, param)
+	}
+	c.params[fl] = fn.params
+	c.results[fl] = fn.result
+	if err := c.block(fl.Body, body, fn.result, true); err != nil {
+		return nil, err
+	}
+	return fn, nil
+}
+
+// Rejects names that Go reserves, which can't be used as variables in the emitted code
+func checkName(name string) error {
+	if gotoken.IsKeyword(name) {
+		return fmt.Errorf("transpile: %s is a reserved word in Go", name)
+	}
+	return nil
+}
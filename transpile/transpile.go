@@ -0,0 +1,235 @@
+// Transpiler for the Clear programming language
+// Walks the AST and emits equivalent Go source for a subset of Clear: let statements, functions, integer & boolean arithmetic, and if expressions
+// Go is statically typed while Clear isn't, so the type of every value is inferred first (see check.go)
+// Programs whose types can't be inferred, or that use anything outside the subset, are rejected with an error
+// The emitted statements are meant to be placed inside a Go function with no result, such as main
+package transpile
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ajtroup1/clearv2/ast"
+)
+
+// Keeps track of the Go source being written and how deeply it's indented
+type transpiler struct {
+	out     bytes.Buffer
+	indent  int
+	checker *checker // Types inferred for the program, used to declare variables & function signatures
+}
+
+// Emits Go source equivalent to the given program
+// Returns an error if the program contains a node outside the supported subset, or a value whose type can't be inferred
+func ToGo(program *ast.Program) (string, error) {
+	c := newChecker()
+	if err := c.program(program); err != nil {
+		return "", err
+	}
+	t := &transpiler{checker: c}
+	for _, stmt := range program.Statements {
+		if err := t.statement(stmt, false); err != nil {
+			return "", err
+		}
+	}
+	return t.out.String(), nil
+}
+
+// Writes a single line at the current indentation
+func (t *transpiler) line(format string, a ...interface{}) {
+	t.out.WriteString(strings.Repeat("\t", t.indent))
+	t.out.WriteString(fmt.Sprintf(format, a...))
+	t.out.WriteString("\n")
+}
+
+// Emits a statement
+// Statements in tail position (the last statement of a function body) return their value, since Clear returns the last expression implicitly
+func (t *transpiler) statement(stmt ast.Statement, tail bool) error {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return t.let(stmt)
+
+	case *ast.ReturnStatement:
+		value, err := t.expression(stmt.ReturnValue)
+		if err != nil {
+			return err
+		}
+		t.line("return %s", value)
+
+	case *ast.ExpressionStatement:
+		// If expressions become if statements, since Go's if isn't an expression
+		if ifExp, ok := stmt.Expression.(*ast.IfExpression); ok {
+			return t.ifStatement(ifExp, tail)
+		}
+		value, err := t.expression(stmt.Expression)
+		if err != nil {
+			return err
+		}
+		switch {
+		case tail:
+			t.line("return %s", value)
+		case isCall(stmt.Expression):
+			t.line("%s", value)
+		default:
+			// Go doesn't allow unused expressions as statements, so the value is discarded explicitly
+			t.line("_ = %s", value)
+		}
+
+	default:
+		return fmt.Errorf("transpile: unsupported statement %T", stmt)
+	}
+	return nil
+}
+
+// Emits a let statement as a Go variable declaration with its inferred type: "var x int64 = 5"
+// Functions are declared before they're assigned, so their bodies can refer to them recursively
+// Go rejects unused local variables, so a let whose name is never used only evaluates its value
+func (t *transpiler) let(stmt *ast.LetStatement) error {
+	name := stmt.Name.Value
+	b := t.checker.lets[stmt]
+	value, err := t.expression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	if !b.used {
+		t.line("_ = %s", value)
+		return nil
+	}
+	typ, ok := b.typ.goString()
+	if !ok {
+		return fmt.Errorf("transpile: can't infer the type of %s", name)
+	}
+	if _, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		t.line("var %s %s", name, typ)
+		t.line("%s = %s", name, value)
+		return nil
+	}
+	t.line("var %s %s = %s", name, typ, value)
+	return nil
+}
+
+// Emits an if expression as a Go if statement
+func (t *transpiler) ifStatement(ie *ast.IfExpression, tail bool) error {
+	// A function can't end in an if without an else, since Go requires every path to return a value
+	if tail && ie.Alternative == nil {
+		return fmt.Errorf("transpile: if without else can't be used as a function's result")
+	}
+	condition, err := t.expression(ie.Condition)
+	if err != nil {
+		return err
+	}
+	t.line("if %s {", condition)
+	if err := t.block(ie.Consequence, tail); err != nil {
+		return err
+	}
+	if ie.Alternative != nil {
+		t.line("} else {")
+		if err := t.block(ie.Alternative, tail); err != nil {
+			return err
+		}
+	}
+	t.line("}")
+	return nil
+}
+
+// Emits the statements of a block one level deeper
+// When the block is in tail position, so is its last statement
+func (t *transpiler) block(block *ast.BlockStatement, tail bool) error {
+	t.indent++
+	for i, stmt := range block.Statements {
+		if err := t.statement(stmt, tail && i == len(block.Statements)-1); err != nil {
+			return err
+		}
+	}
+	t.indent--
+	return nil
+}
+
+// Returns the Go source of an expression
+func (t *transpiler) expression(exp ast.Expression) (string, error) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return exp.Token.Literal, nil
+
+	case *ast.Boolean:
+		return exp.Token.Literal, nil
+
+	case *ast.Identifier:
+		return exp.Value, nil
+
+	case *ast.PrefixExpression:
+		right, err := t.expression(exp.Right)
+		if err != nil {
+			return "", err
+		}
+		return "(" + exp.Operator + right + ")", nil
+
+	case *ast.InfixExpression:
+		switch exp.Operator {
+		case "+", "-", "*", "/", "<", ">", "==", "!=":
+		default:
+			return "", fmt.Errorf("transpile: unsupported operator %s", exp.Operator)
+		}
+		left, err := t.expression(exp.Left)
+		if err != nil {
+			return "", err
+		}
+		right, err := t.expression(exp.Right)
+		if err != nil {
+			return "", err
+		}
+		return "(" + left + " " + exp.Operator + " " + right + ")", nil
+
+	case *ast.CallExpression:
+		function, err := t.expression(exp.Function)
+		if err != nil {
+			return "", err
+		}
+		args := []string{}
+		for _, a := range exp.Arguments {
+			arg, err := t.expression(a)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, arg)
+		}
+		return function + "(" + strings.Join(args, ", ") + ")", nil
+
+	case *ast.FunctionLiteral:
+		return t.functionLiteral(exp)
+
+	default:
+		return "", fmt.Errorf("transpile: unsupported expression %T", exp)
+	}
+}
+
+// Returns the Go source of a function literal: "fn(x, y) { x + y }" becomes "func(x int64, y int64) int64 { return (x + y) }"
+func (t *transpiler) functionLiteral(fl *ast.FunctionLiteral) (string, error) {
+	params := []string{}
+	for i, p := range fl.Parameters {
+		typ, ok := t.checker.params[fl][i].goString()
+		if !ok {
+			return "", fmt.Errorf("transpile: can't infer the type of parameter %s", p.Value)
+		}
+		params = append(params, p.Value+" "+typ)
+	}
+	result, ok := t.checker.results[fl].goString()
+	if !ok {
+		return "", fmt.Errorf("transpile: can't infer the result type of %s", fl.String())
+	}
+	signature := "func(" + strings.Join(params, ", ") + ") " + result + " {"
+
+	// The body is written with its own transpiler so it can be nested inside the current line
+	body := &transpiler{indent: t.indent, checker: t.checker}
+	if err := body.block(fl.Body, true); err != nil {
+		return "", err
+	}
+	return signature + "\n" + body.out.String() + strings.Repeat("\t", t.indent) + "}", nil
+}
+
+// Reports whether the expression is a function call, which Go allows as a statement on its own
+func isCall(exp ast.Expression) bool {
+	_, ok := exp.(*ast.CallExpression)
+	return ok
+}
@@ -0,0 +1,133 @@
+package transpile
+
+import (
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"github.com/ajtroup1/clearv2/lexer"
+	clearparser "github.com/ajtroup1/clearv2/parser"
+)
+
+func parse(t *testing.T, input string) string {
+	l := lexer.New(input)
+	p := clearparser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	out, err := ToGo(program)
+	if err != nil {
+		t.Fatalf("ToGo returned error: %s", err)
+	}
+	return out
+}
+
+// Places the generated Go inside a main function and type-checks it, failing the test if it wouldn't compile
+func typeCheck(t *testing.T, generated string) {
+	src := "package main\nfunc main() {\n" + generated + "}\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated Go doesn't parse: %s\n%s", err, src)
+	}
+	conf := types.Config{}
+	if _, err := conf.Check("main", fset, []*goast.File{file}, nil); err != nil {
+		t.Fatalf("generated Go doesn't compile: %s\n%s", err, src)
+	}
+}
+
+func TestToGo(t *testing.T) {
+	input := `
+	let max = fn(a, b) { if (a > b) { a } else { b } };
+	let double = fn(x) { return x * 2; };
+	let y = max(1, -2) + double(3);
+	if (y != 8) { max(y, 0); }
+	y == 8;
+	`
+
+	expected := `var max func(int64, int64) int64
+max = func(a int64, b int64) int64 {
+	if (a > b) {
+		return a
+	} else {
+		return b
+	}
+}
+var double func(int64) int64
+double = func(x int64) int64 {
+	return (x * 2)
+}
+var y int64 = (max(1, (-2)) + double(3))
+if (y != 8) {
+	max(y, 0)
+}
+_ = (y == 8)
+`
+
+	actual := parse(t, input)
+	if actual != expected {
+		t.Fatalf("wrong Go output.\nexpected=\n%s\ngot=\n%s", expected, actual)
+	}
+	typeCheck(t, actual)
+}
+
+func TestToGoCompiles(t *testing.T) {
+	tests := []string{
+		// Recursion
+		`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5);`,
+		// Booleans
+		`let positive = fn(x) { x > 0 }; let b = !positive(3); if (b == true) { 1; }`,
+		// Higher-order functions, with parameter types decided by how they're used
+		`let apply = fn(f, x) { f(x) }; let inc = fn(n) { n + 1 }; apply(inc, 2);`,
+		`let twice = fn(f) { fn(x) { f(f(x)) } }; let add = fn(n) { n + 3 }; twice(add)(1);`,
+		// Lets that are never used
+		`let unused = 5; let alsoUnused = fn(x) { x * 2 };`,
+		`let f = fn(x) { let unused = x + 1; x }; f(1);`,
+		// Returns from inside a function
+		`let clamp = fn(x) { if (x > 10) { return 10; } x }; clamp(12);`,
+	}
+
+	for _, input := range tests {
+		typeCheck(t, parse(t, input))
+	}
+}
+
+func TestToGoUnsupported(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let a = [1, 2];`, "transpile: unsupported expression *ast.ArrayLiteral"},
+		{`"hello"`, "transpile: unsupported expression *ast.StringLiteral"},
+		{`let f = fn(x) { if (x > 1) { x } };`, "transpile: if without else can't be used as a function's result"},
+		{`return 5;`, "transpile: return outside a function is unsupported"},
+		{`1 + true`, "transpile: type mismatch: int64 + bool"},
+		{`!5`, "transpile: type mismatch: !int64"},
+		{`if (1) { 2; }`, "transpile: if condition must be bool, got int64"},
+		{`let f = fn(x) { x }; f(1); f(true);`, "transpile: type mismatch: func(int64) int64 called as func(bool) ?"},
+		{`let f = fn(x) { x };`, "transpile: can't infer the type of parameter x"},
+		{`let f = fn() { let x = 1; }; f();`, "transpile: function must end in an expression or return, got let x"},
+		{`let f = fn() { }; f();`, "transpile: function must end in an expression or return, got an empty block"},
+		{`len(1)`, "transpile: undefined identifier len"},
+		{`let x = 1; let x = 2;`, "transpile: x is already declared in this scope"},
+		{`let func = 1;`, "transpile: func is a reserved word in Go"},
+		{`let f = fn(a) { a }; let g = fn(a) { a }; f == g`, "transpile: == can only compare int64 or bool, got func(?) ?"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := clearparser.New(l)
+		program := p.ParseProgram()
+		_, err := ToGo(program)
+		if err == nil {
+			t.Errorf("expected error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}